@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/SlyMarbo/rss"
+)
+
+// browserSink opens the link of every item in the default browser once all
+// items are written. Failing to open a link is logged rather than returned,
+// so triage never prevents items from being marked read.
+type browserSink struct {
+	links []string
+	limit int
+}
+
+func (s *browserSink) Write(item *rss.Item) error {
+	if item.Link != "" {
+		s.links = append(s.links, item.Link)
+	}
+
+	return nil
+}
+
+func (s *browserSink) Flush() error {
+	if len(s.links) == 0 {
+		return nil
+	}
+
+	name, args, err := browserCommand()
+	if err != nil {
+		log.Printf("not opening %d links: %s", len(s.links), err)
+		return nil
+	}
+
+	if s.limit > 0 && len(s.links) > s.limit && !confirm(fmt.Sprintf("open %d links in the browser?", len(s.links))) {
+		log.Printf("not opening %d links, more than -open-limit of %d", len(s.links), s.limit)
+		return nil
+	}
+
+	for _, link := range s.links {
+		if err := exec.Command(name, append(args, link)...).Run(); err != nil {
+			log.Printf("failed to open %s: %s", link, err)
+		}
+	}
+
+	return nil
+}
+
+// browserCommand returns the platform's command for opening a url, or an
+// error when there is no browser to open it with.
+func browserCommand() (string, []string, error) {
+	var name string
+	var args []string
+	switch runtime.GOOS {
+	case "darwin":
+		name = "open"
+	case "windows":
+		name, args = "rundll32", []string{"url.dll,FileProtocolHandler"}
+	default:
+		if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			return "", nil, fmt.Errorf("no display available")
+		}
+		name = "xdg-open"
+	}
+
+	if _, err := exec.LookPath(name); err != nil {
+		return "", nil, err
+	}
+
+	return name, args, nil
+}
+
+// confirm asks the question on stderr and reports whether it was answered
+// with yes. It is never confirmed when stdin is not a terminal.
+func confirm(question string) bool {
+	if !isTerminal(os.Stdin) {
+		return false
+	}
+
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const defaultCacheFormat string = "json"
+
+// gobCacheHeader starts every gob cache, identifying its format on load.
+const gobCacheHeader string = "sec-feed gob cache\n"
+
+// cacheCodec serializes the cached feed in one -cache-format.
+type cacheCodec interface {
+	encode(feed *cachedFeed) ([]byte, error)
+	decode(data []byte, feed *cachedFeed) error
+}
+
+// cacheCodecs maps each -cache-format to its codec.
+var cacheCodecs = map[string]cacheCodec{
+	"json": jsonCacheCodec{},
+	"gob":  gobCacheCodec{},
+}
+
+// jsonCacheCodec keeps the cache readable, at the cost of its size.
+type jsonCacheCodec struct{}
+
+func (jsonCacheCodec) encode(feed *cachedFeed) ([]byte, error) {
+	return json.Marshal(feed)
+}
+
+func (jsonCacheCodec) decode(data []byte, feed *cachedFeed) error {
+	return json.Unmarshal(data, feed)
+}
+
+// gobCacheCodec writes a smaller cache that is faster to load and save.
+// The item map is left out, as gob can't encode its empty struct values,
+// and is rebuilt from the items on the next update.
+type gobCacheCodec struct{}
+
+func (gobCacheCodec) encode(feed *cachedFeed) ([]byte, error) {
+	cached := *feed
+	if feed.Feed != nil {
+		upstream := *feed.Feed
+		upstream.ItemMap = nil
+		cached.Feed = &upstream
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(gobCacheHeader)
+	if err := gob.NewEncoder(&buf).Encode(&cached); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (gobCacheCodec) decode(data []byte, feed *cachedFeed) error {
+	return gob.NewDecoder(bytes.NewReader(bytes.TrimPrefix(data, []byte(gobCacheHeader)))).Decode(feed)
+}
+
+// cacheCodecFor returns the codec of a -cache-format.
+func cacheCodecFor(format string) (cacheCodec, error) {
+	codec, ok := cacheCodecs[strings.ToLower(format)]
+	if !ok {
+		var formats []string
+		for name := range cacheCodecs {
+			formats = append(formats, name)
+		}
+		sort.Strings(formats)
+
+		return nil, fmt.Errorf("unknown cache format %s, expected one of: %s", format, strings.Join(formats, ", "))
+	}
+
+	return codec, nil
+}
+
+// detectCacheCodec returns the codec a cache was written with, regardless
+// of -cache-format, so changing the format rewrites an existing cache in the
+// new format rather than discarding it.
+func detectCacheCodec(data []byte) cacheCodec {
+	if bytes.HasPrefix(data, []byte(gobCacheHeader)) {
+		return gobCacheCodec{}
+	}
+
+	return jsonCacheCodec{}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SlyMarbo/rss"
+)
+
+func TestCacheFormatRoundTrip(t *testing.T) {
+	firstSeen := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+	lastRun := time.Date(2021, time.March, 2, 8, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		write string
+		// rewrite, when set, is the format the loaded cache is written in next
+		rewrite string
+	}{
+		{write: "json"},
+		{write: "gob"},
+		{write: "json", rewrite: "gob"},
+		{write: "gob", rewrite: "json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.write+">"+tt.rewrite, func(t *testing.T) {
+			useTestCache(t)
+			cachePath := filepath.Join(t.TempDir(), cacheFile)
+
+			feed := &cachedFeed{
+				Feed: &rss.Feed{
+					Title:     "test feed",
+					UpdateURL: "https://example.com/feed.xml",
+					Items: []*rss.Item{
+						{ID: "1", Title: "CVE-2021-0001 (openssl)", Read: true},
+						{ID: "2", Title: "CVE-2021-0002 (nginx)"},
+					},
+					ItemMap: map[string]struct{}{"1": {}, "2": {}},
+					Unread:  1,
+				},
+				Hashes:    map[string]string{"1": "a", "2": "b"},
+				FirstSeen: map[string]time.Time{"1": firstSeen, "2": firstSeen.Add(time.Hour)},
+				LastRun:   lastRun,
+			}
+
+			formats := []string{tt.write}
+			if tt.rewrite != "" {
+				formats = append(formats, tt.rewrite)
+			}
+
+			cached := feed
+			for _, format := range formats {
+				codec, err := cacheCodecFor(format)
+				if err != nil {
+					t.Fatalf("cacheCodecFor(%q) error = %s", format, err)
+				}
+				cacheEncoding = codec
+
+				if err := writeCache(cachePath, cached); err != nil {
+					t.Fatalf("writeCache() in %s error = %s", format, err)
+				}
+
+				if cached, err = loadCachedFeed(cachePath); err != nil {
+					t.Fatalf("loadCachedFeed() of %s error = %s", format, err)
+				}
+			}
+
+			if got := itemIDs(cached); got != "1,2*" || cached.Unread != 1 {
+				t.Errorf("cached items = %s with %d unread, want 1,2* with 1", got, cached.Unread)
+			}
+
+			for id, want := range feed.FirstSeen {
+				if got := cached.FirstSeen[id]; !got.Equal(want) {
+					t.Errorf("item %s first seen = %s, want %s", id, got, want)
+				}
+			}
+
+			if !cached.LastRun.Equal(lastRun) {
+				t.Errorf("last run = %s, want %s", cached.LastRun, lastRun)
+			}
+
+			if cached.Hashes["1"] != "a" || cached.Hashes["2"] != "b" || cached.Title != "test feed" {
+				t.Errorf("cached hashes = %v, title %q, want the written ones", cached.Hashes, cached.Title)
+			}
+		})
+	}
+}
+
+func TestCacheCodecFor(t *testing.T) {
+	tests := []struct {
+		format  string
+		want    cacheCodec
+		wantErr bool
+	}{
+		{format: "json", want: jsonCacheCodec{}},
+		{format: "gob", want: gobCacheCodec{}},
+		{format: "GOB", want: gobCacheCodec{}},
+		{format: "msgpack", wantErr: true},
+		{format: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := cacheCodecFor(tt.format)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("cacheCodecFor(%q) = %T, %v, want %T", tt.format, got, err, tt.want)
+		}
+	}
+}
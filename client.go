@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SlyMarbo/rss"
+)
+
+// newFetchClient returns the http client used for every feed request, sending
+// headers with each of them.
+func newFetchClient(insecure bool, maxRedirects int, headers http.Header) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	var rt http.RoundTripper = transport
+	if len(headers) > 0 {
+		rt = &headerTransport{headers: headers, next: transport}
+	}
+
+	return &http.Client{
+		Transport: rt,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects at %s", maxRedirects, req.URL)
+			}
+
+			verbosef("following redirect from %s to %s", via[len(via)-1].URL, req.URL)
+			return nil
+		},
+	}
+}
+
+// headerTransport adds a fixed set of headers to every request, including
+// those made following a redirect to the same host. A redirect to another
+// host is sent without them, as they often hold credentials.
+type headerTransport struct {
+	headers http.Header
+	next    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.EqualFold(req.URL.Host, originalRequest(req).URL.Host) {
+		return t.next.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	for key, values := range t.headers {
+		req.Header[key] = values
+	}
+
+	return t.next.RoundTrip(req)
+}
+
+// originalRequest returns the request that req was redirected from, directly
+// or through a chain of redirects, or req itself if it isn't a redirect.
+func originalRequest(req *http.Request) *http.Request {
+	for req.Response != nil && req.Response.Request != nil {
+		req = req.Response.Request
+	}
+
+	return req
+}
+
+// parseHeaders parses -header values of the form "Key: Value". Repeating a
+// key sends each of its values.
+func parseHeaders(specs []string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, spec := range specs {
+		key, value, ok := strings.Cut(spec, ":")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || !validHeaderName(key) {
+			return nil, fmt.Errorf("invalid header %q, expected \"Key: Value\"", spec)
+		}
+
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("invalid header %q, values cannot contain line breaks", spec)
+		}
+
+		headers.Add(key, value)
+	}
+
+	return headers, nil
+}
+
+// validHeaderName reports whether name is a non-empty http token.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, r := range name {
+		if r > 0x7e || r <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getWithRetries gets url, retrying up to -fetch-retries times when the
+// server is rate limiting or unavailable and says when to retry with a
+// Retry-After header. Waits are capped at -max-retry-wait.
+func getWithRetries(client *http.Client, url string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := client.Get(url)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+			return resp, nil
+		}
+
+		wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok || attempt >= fetchRetries {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		if wait > maxRetryWait {
+			wait = maxRetryWait
+		}
+
+		log.Printf("fetching %s returned status %s, retrying in %s", url, resp.Status, wait)
+		time.Sleep(wait)
+	}
+}
+
+// parseRetryAfter returns how long a Retry-After header value, either a
+// number of seconds or an http date, asks to wait from now.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	wait := date.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+
+	return wait, true
+}
+
+// fetchFeedResponse gets the feed at url. An html page is rejected unless
+// discover is set, when the feed it links to is fetched instead.
+func fetchFeedResponse(client *http.Client, url string, discover bool) (*http.Response, error) {
+	resp, err := getWithRetries(client, url)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetching %s returned status %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(http.DetectContentType(body), "text/html") {
+		if !discover {
+			return nil, fmt.Errorf("fetching %s returned an html page rather than a feed", url)
+		}
+
+		links := discoverFeedLinks(body, resp.Request.URL)
+		if len(links) == 0 {
+			return nil, fmt.Errorf("fetching %s returned an html page without any feed links", url)
+		}
+
+		log.Printf("using the feed %s discovered at %s", links[0], url)
+		verbosef("feeds discovered at %s: %s", url, strings.Join(links, ", "))
+		return fetchFeedResponse(client, links[0], false)
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+var (
+	linkTagPattern   = regexp.MustCompile(`(?is)<link\b[^>]*>`)
+	htmlAttrPattern  = regexp.MustCompile(`(?is)([a-z-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	feedContentTypes = map[string]bool{
+		"application/rss+xml":  true,
+		"application/atom+xml": true,
+	}
+)
+
+// discoverFeedLinks returns the urls of the feeds an html page advertises
+// with <link rel="alternate"> tags, in page order and resolved against base.
+func discoverFeedLinks(page []byte, base *neturl.URL) []string {
+	var links []string
+	for _, tag := range linkTagPattern.FindAll(page, -1) {
+		attrs := make(map[string]string)
+		for _, m := range htmlAttrPattern.FindAllSubmatch(tag, -1) {
+			attrs[strings.ToLower(string(m[1]))] = html.UnescapeString(string(m[2]) + string(m[3]) + string(m[4]))
+		}
+
+		alternate := false
+		for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+			alternate = alternate || rel == "alternate"
+		}
+
+		if !alternate || !feedContentTypes[strings.ToLower(strings.TrimSpace(attrs["type"]))] || attrs["href"] == "" {
+			continue
+		}
+
+		href, err := base.Parse(strings.TrimSpace(attrs["href"]))
+		if err != nil {
+			continue
+		}
+
+		links = append(links, href.String())
+	}
+
+	return links
+}
+
+// fetchUpstream fetches and parses the feed at url, rejecting error statuses
+// and HTML pages, such as an upstream maintenance notice, before they are
+// parsed into a feed.
+func fetchUpstream(client *http.Client, url string) (*rss.Feed, error) {
+	// the response body is read while fetching, so the remaining time is
+	// spent parsing it
+	var fetching time.Duration
+	fetchFunc := func(url string) (*http.Response, error) {
+		start := time.Now()
+		defer func() {
+			fetching += time.Since(start)
+		}()
+
+		return fetchFeedResponse(client, url, autodiscover)
+	}
+
+	start := time.Now()
+	feed, err := rss.FetchByFunc(fetchFunc, url)
+	if err != nil {
+		return nil, err
+	}
+	verbosef("fetched %s in %s and parsed it in %s", url, fetching, time.Since(start)-fetching)
+
+	if feed == nil {
+		return nil, fmt.Errorf("%s returned no feed", url)
+	}
+
+	if len(feed.Items) == 0 && feed.Title == "" {
+		return nil, fmt.Errorf("%s contains neither items nor a feed title", url)
+	}
+
+	return feed, nil
+}
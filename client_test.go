@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value    string
+		wantWait time.Duration
+		wantOk   bool
+	}{
+		{value: "", wantOk: false},
+		{value: "0", wantWait: 0, wantOk: true},
+		{value: "120", wantWait: 2 * time.Minute, wantOk: true},
+		{value: "-5", wantOk: false},
+		{value: "soon", wantOk: false},
+		{value: "Wed, 01 Jan 2020 00:01:30 GMT", wantWait: 90 * time.Second, wantOk: true},
+		{value: "Tue, 31 Dec 2019 23:59:00 GMT", wantWait: 0, wantOk: true},
+	}
+
+	for _, tt := range tests {
+		wait, ok := parseRetryAfter(tt.value, now)
+		if wait != tt.wantWait || ok != tt.wantOk {
+			t.Errorf("parseRetryAfter(%q) = %s, %t, want %s, %t", tt.value, wait, ok, tt.wantWait, tt.wantOk)
+		}
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	tests := []struct {
+		specs   []string
+		want    http.Header
+		wantErr bool
+	}{
+		{specs: nil, want: http.Header{}},
+		{specs: []string{"X-Api-Version: 2"}, want: http.Header{"X-Api-Version": {"2"}}},
+		{specs: []string{"  x-tenant :  acme  "}, want: http.Header{"X-Tenant": {"acme"}}},
+		{specs: []string{"Accept: a", "accept: b"}, want: http.Header{"Accept": {"a", "b"}}},
+		{specs: []string{"Authorization: Bearer a:b"}, want: http.Header{"Authorization": {"Bearer a:b"}}},
+		{specs: []string{"X-Empty:"}, want: http.Header{"X-Empty": {""}}},
+		{specs: []string{"no separator"}, wantErr: true},
+		{specs: []string{": value"}, wantErr: true},
+		{specs: []string{"Bad Name: value"}, wantErr: true},
+		{specs: []string{"X-Split: a\r\nX-Injected: b"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseHeaders(tt.specs)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseHeaders(%q) error = %v, want error %t", tt.specs, err, tt.wantErr)
+			continue
+		}
+
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseHeaders(%q) = %v, want %v", tt.specs, got, tt.want)
+		}
+	}
+}
+
+func TestFetchUpstream(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		items   int
+		wantErr string
+	}{
+		{
+			name:   "feed",
+			status: http.StatusOK,
+			body:   `<?xml version="1.0"?><rss version="2.0"><channel><title>feed</title><item><title>CVE-2021-0001</title><guid>1</guid></item></channel></rss>`,
+			items:  1,
+		},
+		{
+			name:   "feed without items",
+			status: http.StatusOK,
+			body:   `<?xml version="1.0"?><rss version="2.0"><channel><title>feed</title></channel></rss>`,
+		},
+		{
+			name:    "maintenance page",
+			status:  http.StatusOK,
+			body:    `<!DOCTYPE html><html><head><title>Down for maintenance</title></head><body>Back soon</body></html>`,
+			wantErr: "html page",
+		},
+		{
+			name:    "empty channel",
+			status:  http.StatusOK,
+			body:    `<?xml version="1.0"?><rss version="2.0"><channel></channel></rss>`,
+			wantErr: "neither items nor a feed title",
+		},
+		{
+			name:    "error status",
+			status:  http.StatusInternalServerError,
+			body:    `<?xml version="1.0"?><rss version="2.0"><channel><title>feed</title></channel></rss>`,
+			wantErr: "500",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+
+			feed, err := fetchUpstream(srv.Client(), srv.URL)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("fetchUpstream() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("fetchUpstream() error = %s", err)
+			}
+
+			if len(feed.Items) != tt.items {
+				t.Errorf("fetchUpstream() returned %d items, want %d", len(feed.Items), tt.items)
+			}
+		})
+	}
+}
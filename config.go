@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const maskedValue string = "********"
+
+// flagEnvKeys holds the environment variables of flags not named after them.
+var flagEnvKeys = map[string]string{
+	"format":       "SEC_FEED_OUTPUT_FORMAT",
+	"sink":         "SEC_FEED_SINKS",
+	"allow-domain": "SEC_FEED_ALLOW_DOMAINS",
+	"deny-domain":  "SEC_FEED_DENY_DOMAINS",
+	"route":        "SEC_FEED_ROUTES",
+	"header":       "SEC_FEED_HEADERS",
+}
+
+// secretFlags are flags whose values are masked when printing the config.
+var secretFlags = map[string]bool{
+	"pagerduty-routing-key": true,
+	"teams-webhook":         true,
+	"matrix-token":          true,
+	"jira-token":            true,
+	"github-token":          true,
+}
+
+// registerSecretFileFlags adds a -<name>-file companion for every secret
+// flag, returning the resulting file paths keyed by the secret's flag name.
+func registerSecretFileFlags(fs *flag.FlagSet) map[string]*string {
+	files := make(map[string]*string, len(secretFlags))
+	for name := range secretFlags {
+		fileFlag := name + "-file"
+		files[name] = fs.String(fileFlag, getEnvOr(envKeyForFlag(fileFlag), ""), "a file containing the -"+name+" value, keeping it out of process listings")
+	}
+
+	return files
+}
+
+// loadSecretFiles sets each secret flag not given on the command line from
+// the contents of its companion file, so a file takes precedence over the
+// environment but not over the flag itself.
+func loadSecretFiles(fs *flag.FlagSet, files map[string]*string) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	for name, path := range files {
+		if *path == "" || set[name] {
+			continue
+		}
+
+		data, err := os.ReadFile(*path)
+		if err != nil {
+			return fmt.Errorf("failed to read -%s-file: %s", name, err)
+		}
+
+		if err := fs.Lookup(name).Value.Set(strings.TrimRight(string(data), "\r\n")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// configFlags are flags controlling the invocation rather than configuring
+// it, left out of the printed config and not settable by profiles.
+var configFlags = map[string]bool{
+	"help":         true,
+	"print-config": true,
+	"config":       true,
+	"profile":      true,
+}
+
+// configFile is the file read with -config. Each profile maps flag names to
+// the values applied when it is selected with -profile.
+type configFile struct {
+	Profiles map[string]map[string]interface{} `json:"profiles"`
+}
+
+// profileFlags holds the flags set by the selected profile.
+var profileFlags = make(map[string]bool)
+
+func loadConfigFile(path string) (*configFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// keep numbers as written so large values aren't formatted as floats
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	cfg := &configFile{}
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %s", path, err)
+	}
+
+	return cfg, nil
+}
+
+// applyProfile sets every flag of the named profile that wasn't given on the
+// command line, so profiles take precedence over the environment and are
+// overridden by explicit flags. Lists set repeatable flags once per value.
+func applyProfile(fs *flag.FlagSet, cfg *configFile, name string) error {
+	profile, ok := cfg.Profiles[name]
+	if !ok {
+		return fmt.Errorf("profile %s not found", name)
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	for key, value := range profile {
+		f := fs.Lookup(key)
+		if f == nil || configFlags[key] {
+			return fmt.Errorf("profile %s sets unknown option %s", name, key)
+		} else if set[key] {
+			continue
+		}
+
+		values := []interface{}{value}
+		if list, ok := value.([]interface{}); ok {
+			values = list
+		}
+
+		for _, v := range values {
+			if err := f.Value.Set(fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("profile %s sets invalid %s: %s", name, key, err)
+			}
+		}
+
+		profileFlags[key] = true
+	}
+
+	return nil
+}
+
+// configValue is a resolved flag value along with where it was set, one of
+// flag, file, profile, env or default.
+type configValue struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+	Env    string `json:"env"`
+}
+
+// envKeyForFlag returns the environment variable a flag's default is read
+// from.
+func envKeyForFlag(name string) string {
+	if key, ok := flagEnvKeys[name]; ok {
+		return key
+	}
+
+	return "SEC_FEED_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// maskConfigValue hides secrets in a flag value, including the urls of
+// webhook sinks which commonly embed a token and the values of headers.
+func maskConfigValue(name, value string) string {
+	if value == "" {
+		return value
+	}
+
+	if secretFlags[name] {
+		return maskedValue
+	}
+
+	values := strings.Split(value, ",")
+	for i, v := range values {
+		if name == "header" {
+			if key, _, ok := strings.Cut(v, ":"); ok {
+				values[i] = key + ": " + maskedValue
+			}
+		} else if idx := strings.Index(v, "webhook="); idx >= 0 {
+			values[i] = v[:idx] + "webhook=" + maskedValue
+		}
+	}
+
+	return strings.Join(values, ",")
+}
+
+// resolvedConfig returns every parsed flag's effective value keyed by flag
+// name.
+func resolvedConfig(fs *flag.FlagSet) map[string]configValue {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	config := make(map[string]configValue)
+	fs.VisitAll(func(f *flag.Flag) {
+		if configFlags[f.Name] {
+			return
+		}
+
+		env := envKeyForFlag(f.Name)
+		source := "default"
+		if set[f.Name] {
+			source = "flag"
+		} else if file := fs.Lookup(f.Name + "-file"); secretFlags[f.Name] && file != nil && file.Value.String() != "" {
+			source = "file"
+		} else if profileFlags[f.Name] {
+			source = "profile"
+		} else if _, ok := os.LookupEnv(env); ok {
+			source = "env"
+		}
+
+		config[f.Name] = configValue{
+			Value:  maskConfigValue(f.Name, f.Value.String()),
+			Source: source,
+			Env:    env,
+		}
+	})
+
+	return config
+}
+
+// printConfig writes the resolved configuration to stdout as JSON.
+func printConfig(fs *flag.FlagSet) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(resolvedConfig(fs))
+}
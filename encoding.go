@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// utf8BOM is written at the start of output files with -bom.
+const utf8BOM string = "\xef\xbb\xbf"
+
+// encodeFileOutput applies -bom and -line-ending to the full contents of an
+// output file.
+func encodeFileOutput(data []byte) []byte {
+	if lineEnding == "crlf" {
+		data = toCRLF(data, false)
+	}
+
+	if bom {
+		data = append([]byte(utf8BOM), data...)
+	}
+
+	return data
+}
+
+// toCRLF converts the lone LFs of data to CRLF. afterCR reports whether the
+// byte preceding data was a CR, for data written in parts.
+func toCRLF(data []byte, afterCR bool) []byte {
+	var buf bytes.Buffer
+	for _, b := range data {
+		if b == '\n' && !afterCR {
+			buf.WriteByte('\r')
+		}
+		buf.WriteByte(b)
+		afterCR = b == '\r'
+	}
+
+	return buf.Bytes()
+}
+
+// encodingWriter applies -bom and -line-ending to output streamed to a file,
+// writing the BOM ahead of the first write when the file starts empty.
+type encodingWriter struct {
+	w       io.Writer
+	bom     bool
+	crlf    bool
+	afterCR bool
+}
+
+// newEncodingWriter wraps the -output-file writer w, or returns it as is when
+// no encoding applies. The BOM is only written to a new or empty regular
+// file, never when appending to existing output.
+func newEncodingWriter(w io.Writer) io.Writer {
+	if !bom && lineEnding != "crlf" {
+		return w
+	}
+
+	return &encodingWriter{
+		w:    w,
+		bom:  bom && isEmptyFile(w),
+		crlf: lineEnding == "crlf",
+	}
+}
+
+func (e *encodingWriter) Write(p []byte) (int, error) {
+	data := p
+	if e.crlf && len(p) > 0 {
+		data = toCRLF(p, e.afterCR)
+		e.afterCR = p[len(p)-1] == '\r'
+	}
+
+	if e.bom {
+		data = append([]byte(utf8BOM), data...)
+	}
+
+	if _, err := e.w.Write(data); err != nil {
+		return 0, err
+	}
+	e.bom = false
+
+	return len(p), nil
+}
+
+// isEmptyFile reports whether w is an empty regular file.
+func isEmptyFile(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+	return err == nil && info.Mode().IsRegular() && info.Size() == 0
+}
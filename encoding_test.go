@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SlyMarbo/rss"
+	"github.com/ncatelli/sec-feed/filter"
+)
+
+// useTestEncoding sets -bom and -line-ending for the test.
+func useTestEncoding(t *testing.T, withBOM bool, ending string) {
+	prevBOM, prevEnding := bom, lineEnding
+	bom, lineEnding = withBOM, ending
+	t.Cleanup(func() { bom, lineEnding = prevBOM, prevEnding })
+}
+
+func TestToCRLF(t *testing.T) {
+	tests := []struct {
+		data    string
+		afterCR bool
+		want    string
+	}{
+		{data: "a\nb\n", want: "a\r\nb\r\n"},
+		{data: "a\r\nb\n", want: "a\r\nb\r\n"},
+		{data: "\n\n", want: "\r\n\r\n"},
+		{data: "no newline", want: "no newline"},
+		// the CR ending the previous write already precedes this LF
+		{data: "\nb\n", afterCR: true, want: "\nb\r\n"},
+		{data: "", afterCR: true, want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := string(toCRLF([]byte(tt.data), tt.afterCR)); got != tt.want {
+			t.Errorf("toCRLF(%q, %t) = %q, want %q", tt.data, tt.afterCR, got, tt.want)
+		}
+	}
+}
+
+func TestEncodingWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		bom      bool
+		ending   string
+		existing string
+		writes   []string
+		want     string
+	}{
+		{name: "plain", ending: "lf", writes: []string{"a\n", "b\n"}, want: "a\nb\n"},
+		{name: "crlf", ending: "crlf", writes: []string{"a\n", "b\n"}, want: "a\r\nb\r\n"},
+		{name: "crlf split across writes", ending: "crlf", writes: []string{"a\r", "\nb\n"}, want: "a\r\nb\r\n"},
+		{name: "bom", bom: true, ending: "lf", writes: []string{"a\n", "b\n"}, want: utf8BOM + "a\nb\n"},
+		{name: "bom and crlf", bom: true, ending: "crlf", writes: []string{"a\n"}, want: utf8BOM + "a\r\n"},
+		{name: "bom appended", bom: true, ending: "lf", existing: utf8BOM + "a\n", writes: []string{"b\n"}, want: utf8BOM + "a\nb\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestEncoding(t, tt.bom, tt.ending)
+			path := filepath.Join(t.TempDir(), "out.txt")
+			if err := os.WriteFile(path, []byte(tt.existing), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := newEncodingWriter(f)
+			for _, s := range tt.writes {
+				if n, err := w.Write([]byte(s)); err != nil || n != len(s) {
+					t.Fatalf("Write(%q) = %d, %v, want %d", s, n, err, len(s))
+				}
+			}
+			f.Close()
+
+			if got, _ := os.ReadFile(path); string(got) != tt.want {
+				t.Errorf("wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCmdExportEncodingRoundTrip(t *testing.T) {
+	useTestCache(t)
+	useTestEncoding(t, true, "crlf")
+
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, cacheFile)
+	exportPath := filepath.Join(dir, "feed.json")
+	filters := filter.Build(map[string][]string{"openssl": {"openssl"}}, nil, "")
+
+	feed := &cachedFeed{Feed: &rss.Feed{Items: []*rss.Item{
+		{ID: "1", Title: "CVE-2021-0001 (openssl)"},
+	}}}
+	if err := cmdExport(feed, cachePath, exportPath, filters, false); err != nil {
+		t.Fatalf("cmdExport() error = %s", err)
+	}
+
+	// appending reads the BOM and CRLF export back before rewriting it
+	feed.Items = append(feed.Items, &rss.Item{ID: "2", Title: "CVE-2021-0002 (openssl)"})
+	if err := cmdExport(feed, cachePath, exportPath, filters, true); err != nil {
+		t.Fatalf("appending cmdExport() error = %s", err)
+	}
+
+	data, err := os.ReadFile(exportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(data, []byte(utf8BOM)) || bytes.Count(data, []byte(utf8BOM)) != 1 {
+		t.Errorf("export holds %d byte order marks, want a single leading one", bytes.Count(data, []byte(utf8BOM)))
+	}
+
+	if lf, crlf := bytes.Count(data, []byte("\n")), bytes.Count(data, []byte("\r\n")); lf == 0 || lf != crlf {
+		t.Errorf("export has %d line feeds, %d of them after a CR, want every line to end in CRLF", lf, crlf)
+	}
+
+	records, err := loadExport(exportPath)
+	if err != nil {
+		t.Fatalf("loadExport() error = %s", err)
+	}
+
+	var ids []string
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+	if got := strings.Join(ids, ","); got != "1,2" {
+		t.Errorf("exported ids = %s, want 1,2", got)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/SlyMarbo/rss"
+)
+
+// runError is a single failure captured for the error summary, with the feed
+// and item it occurred for where known.
+type runError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	URL     string `json:"url,omitempty"`
+	GUID    string `json:"guid,omitempty"`
+}
+
+// errorSummary is appended to the -error-file once per run with failures.
+type errorSummary struct {
+	Time    time.Time  `json:"time"`
+	Command string     `json:"command"`
+	Errors  []runError `json:"errors"`
+}
+
+var runErrors []runError
+
+// itemError associates an error with the item being written when it
+// occurred.
+type itemError struct {
+	guid string
+	err  error
+}
+
+func (e *itemError) Error() string {
+	return e.err.Error()
+}
+
+func (e *itemError) Unwrap() error {
+	return e.err
+}
+
+func newItemError(item *rss.Item, err error) error {
+	var ie *itemError
+	if errors.As(err, &ie) {
+		return err
+	}
+
+	return &itemError{guid: item.ID, err: err}
+}
+
+// recordError adds err to the error summary under code. Failures that are
+// only logged, such as undelivered notifications, record the item's guid.
+func recordError(code string, err error, guid string) {
+	var ie *itemError
+	if guid == "" && errors.As(err, &ie) {
+		guid = ie.guid
+	}
+
+	runErrors = append(runErrors, runError{
+		Code:    code,
+		Message: err.Error(),
+		URL:     feedUrl,
+		GUID:    guid,
+	})
+}
+
+// writeErrorSummary appends the recorded errors as a single JSON object line
+// to path, or to stderr when path is -. Nothing is written without errors.
+func writeErrorSummary(path string) error {
+	if path == "" || len(runErrors) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(errorSummary{
+		Time:    time.Now().UTC(),
+		Command: flag.Arg(0),
+		Errors:  runErrors,
+	})
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if path == "-" {
+		_, err := os.Stderr.Write(data)
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// fatal records err under code and writes the error summary before exiting.
+func fatal(code string, err error) {
+	recordError(code, err, "")
+	if err := writeErrorSummary(errorFile); err != nil {
+		log.Printf("failed to write error summary to %s: %s", errorFile, err)
+	}
+
+	log.Fatal(err)
+}
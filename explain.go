@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/SlyMarbo/rss"
+	"github.com/ncatelli/sec-feed/filter"
+)
+
+// explainOutput receives the explanations of -explain.
+var explainOutput io.Writer = os.Stderr
+
+// explainingMatcher writes why its selector did or didn't select each item,
+// listing every filter tested and the field each of its terms matched.
+// Items that aren't selected are only explained at -verbose.
+type explainingMatcher struct {
+	selector filter.AllMatcher
+	filters  []filter.Filter
+}
+
+func (m explainingMatcher) Matches(item *rss.Item) bool {
+	selected := m.selector.Matches(item)
+	if !selected && !verbose {
+		return false
+	}
+
+	var sb strings.Builder
+	verdict := "selected"
+	if !selected {
+		verdict = "not selected"
+	}
+	fmt.Fprintf(&sb, "explain: %s: %s\n", item.Title, verdict)
+
+	for _, matcher := range m.selector {
+		if option := selectorOption(matcher); option != "" && !matcher.Matches(item) {
+			fmt.Fprintf(&sb, "  rejected by %s\n", option)
+		}
+	}
+
+	for _, f := range m.filters {
+		matched, details := explainFilter(f, item)
+		verdict := "matched"
+		if !matched {
+			verdict = "not matched"
+		}
+		fmt.Fprintf(&sb, "  filter %s %s: %s\n", f.Label, verdict, strings.Join(details, ", "))
+	}
+
+	io.WriteString(explainOutput, sb.String())
+	return selected
+}
+
+// selectorOption returns the options controlling a matcher of the item
+// selector, or an empty string for the filters themselves.
+func selectorOption(m filter.Matcher) string {
+	switch m := m.(type) {
+	case domainMatcher:
+		return "-allow-domain and -deny-domain"
+	case linkMatcher:
+		return "-link-match"
+	case ageMatcher:
+		return "-max-age"
+	case cvssMatcher:
+		return "-attack-vector and -privileges-required"
+	case filter.Filter:
+		return "-only-filter " + m.Label
+	default:
+		return ""
+	}
+}
+
+// explainFilter reports whether f matches item along with how each of its
+// terms did, requiring every term of a group to match.
+func explainFilter(f filter.Filter, item *rss.Item) (bool, []string) {
+	terms, ok := f.Matcher.(filter.AllMatcher)
+	if !ok {
+		terms = filter.AllMatcher{f.Matcher}
+	}
+
+	matched := len(terms) > 0
+	var details []string
+	for _, term := range terms {
+		ok, detail := explainTerm(term, item)
+		matched = matched && ok
+		details = append(details, detail)
+	}
+
+	return matched, details
+}
+
+// explainTerm reports whether a filter term matches item and on which field.
+func explainTerm(m filter.Matcher, item *rss.Item) (bool, string) {
+	switch m := m.(type) {
+	case filter.SubstringMatcher:
+		if m.Matches(item) {
+			return true, fmt.Sprintf("%q in title", m.Term)
+		}
+
+		return false, fmt.Sprintf("%q not in title", m.Term)
+	case filter.GlobMatcher:
+		if m.Pattern.MatchString(item.Title) {
+			return true, fmt.Sprintf("%q matches title", m.Term)
+		}
+
+		for _, tag := range filter.TitleTags(item.Title, m.TagSeparator) {
+			if m.Pattern.MatchString(tag) {
+				return true, fmt.Sprintf("%q matches tag %q", m.Term, tag)
+			}
+		}
+
+		return false, fmt.Sprintf("%q matches neither title nor tags", m.Term)
+	default:
+		if m.Matches(item) {
+			return true, "matched"
+		}
+
+		return false, "not matched"
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SlyMarbo/rss"
+	"github.com/ncatelli/sec-feed/filter"
+)
+
+// domainMatcher matches items whose link is permitted by the allowed and
+// denied domains. See linkAllowed.
+type domainMatcher struct {
+	allow []string
+	deny  []string
+}
+
+func (m domainMatcher) Matches(item *rss.Item) bool {
+	return linkAllowed(item.Link, m.allow, m.deny)
+}
+
+// linkMatcher matches items whose link is a url matching pattern. Items
+// without a parseable absolute link never match.
+type linkMatcher struct {
+	pattern *regexp.Regexp
+}
+
+func (m linkMatcher) Matches(item *rss.Item) bool {
+	u, err := url.Parse(item.Link)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	return m.pattern.MatchString(item.Link)
+}
+
+// ageMatcher matches items published after cutoff. Items without a date are
+// matched when keepUndated is set.
+type ageMatcher struct {
+	cutoff      time.Time
+	keepUndated bool
+}
+
+func (m ageMatcher) Matches(item *rss.Item) bool {
+	if item.Date.IsZero() {
+		return m.keepUndated
+	}
+
+	return item.Date.After(m.cutoff)
+}
+
+// cvssMatcher matches items whose CVSS vector has one of the listed attack
+// vectors and required privileges, where an empty list allows any value.
+// Items without a CVSS vector never match.
+type cvssMatcher struct {
+	attackVectors      map[string]bool
+	privilegesRequired map[string]bool
+}
+
+func (m cvssMatcher) Matches(item *rss.Item) bool {
+	v := itemCVSSVector(item)
+	if v == nil {
+		return false
+	}
+
+	if len(m.attackVectors) > 0 && !m.attackVectors[v.AttackVector] {
+		return false
+	}
+
+	return len(m.privilegesRequired) == 0 || m.privilegesRequired[v.PrivilegesRequired]
+}
+
+// parseCVSSValues parses a comma separated list of named values of a CVSS
+// metric, such as network,adjacent for AV, rejecting values the metric
+// doesn't have.
+func parseCVSSValues(spec, metric string) (map[string]bool, error) {
+	known := make(map[string]bool)
+	var names []string
+	for _, name := range cvssMetricValues[metric] {
+		known[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make(map[string]bool)
+	for _, value := range strings.Split(spec, ",") {
+		if value = strings.ToLower(strings.TrimSpace(value)); value == "" {
+			continue
+		}
+
+		if !known[value] {
+			return nil, fmt.Errorf("unknown value %s, expected one of: %s", value, strings.Join(names, ", "))
+		}
+
+		values[value] = true
+	}
+
+	return values, nil
+}
+
+// newItemSelector returns the matcher selecting the items output by a
+// command: those linking to a permitted domain and, with -link-match, a
+// matching url, no older than -max-age, with a CVSS vector allowed by
+// -attack-vector and -privileges-required when either is set,
+// matched by the -only-filter filter when set and matching any filter.
+// Selected items are recorded in the match report of the run, and with
+// -explain the decision for each item is written to stderr.
+func newItemSelector(filters []filter.Filter) filter.Matcher {
+	selector := filter.AllMatcher{
+		domainMatcher{allow: allowDomains.values, deny: denyDomains.values},
+	}
+
+	if linkPattern != nil {
+		selector = append(selector, linkMatcher{pattern: linkPattern})
+	}
+
+	if maxAge > 0 {
+		selector = append(selector, ageMatcher{cutoff: time.Now().Add(-maxAge), keepUndated: keepUndated})
+	}
+
+	if len(attackVectors) > 0 || len(privilegesRequired) > 0 {
+		selector = append(selector, cvssMatcher{attackVectors: attackVectors, privilegesRequired: privilegesRequired})
+	}
+
+	if f, err := filter.Find(filters, onlyFilter); onlyFilter != "" && err == nil {
+		selector = append(selector, f)
+	}
+
+	selector = append(selector, filter.NewAnyMatcher(filters))
+
+	var matcher filter.Matcher = selector
+	if explain {
+		matcher = explainingMatcher{selector: selector, filters: filters}
+	}
+
+	if runMatchReport != nil {
+		return reportingMatcher{selector: matcher, report: runMatchReport}
+	}
+
+	return matcher
+}
+
+// linkAllowed returns false if the host of link is, or is a subdomain of,
+// a denied domain, or if allow is non-empty and the host matches none of
+// its domains. Unparseable links are only allowed when allow is empty.
+func linkAllowed(link string, allow, deny []string) bool {
+	if len(allow) == 0 && len(deny) == 0 {
+		return true
+	}
+
+	u, err := url.Parse(link)
+	if err != nil || u.Hostname() == "" {
+		return len(allow) == 0
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range deny {
+		if hostInDomain(host, domain) {
+			return false
+		}
+	}
+
+	if len(allow) == 0 {
+		return true
+	}
+
+	for _, domain := range allow {
+		if hostInDomain(host, domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hostInDomain(host, domain string) bool {
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
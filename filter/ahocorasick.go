@@ -0,0 +1,90 @@
+package filter
+
+// literalSet is an Aho-Corasick automaton reporting whether a string
+// contains any of a set of literal terms in a single pass over the string.
+type literalSet struct {
+	next []map[byte]int
+	fail []int
+	out  []bool
+}
+
+func newLiteralSet(terms []string) *literalSet {
+	s := &literalSet{
+		next: []map[byte]int{{}},
+		fail: []int{0},
+		out:  []bool{false},
+	}
+
+	for _, term := range terms {
+		state := 0
+		for i := 0; i < len(term); i++ {
+			next, ok := s.next[state][term[i]]
+			if !ok {
+				next = len(s.next)
+				s.next = append(s.next, map[byte]int{})
+				s.fail = append(s.fail, 0)
+				s.out = append(s.out, false)
+				s.next[state][term[i]] = next
+			}
+			state = next
+		}
+		s.out[state] = true
+	}
+
+	// link every state to its longest proper suffix in the trie, breadth
+	// first so that suffix states are always linked before their extensions.
+	queue := make([]int, 0, len(s.next))
+	for _, child := range s.next[0] {
+		queue = append(queue, child)
+	}
+
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+
+		for b, child := range s.next[state] {
+			queue = append(queue, child)
+
+			fail := s.fail[state]
+			for fail != 0 {
+				if _, ok := s.next[fail][b]; ok {
+					break
+				}
+				fail = s.fail[fail]
+			}
+
+			if target, ok := s.next[fail][b]; ok && target != child {
+				s.fail[child] = target
+			}
+			s.out[child] = s.out[child] || s.out[s.fail[child]]
+		}
+	}
+
+	return s
+}
+
+// containsAny returns true if text contains at least one of the terms.
+func (s *literalSet) containsAny(text string) bool {
+	state := 0
+	if s.out[state] {
+		return true
+	}
+
+	for i := 0; i < len(text); i++ {
+		for {
+			if next, ok := s.next[state][text[i]]; ok {
+				state = next
+				break
+			} else if state == 0 {
+				break
+			}
+			state = s.fail[state]
+		}
+
+		if s.out[state] {
+			return true
+		}
+	}
+
+	return false
+}
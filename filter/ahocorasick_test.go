@@ -0,0 +1,112 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/SlyMarbo/rss"
+)
+
+func TestLiteralSetContainsAny(t *testing.T) {
+	tests := []struct {
+		terms []string
+		text  string
+		want  bool
+	}{
+		{terms: nil, text: "anything", want: false},
+		{terms: []string{""}, text: "", want: true},
+		{terms: []string{"openssl"}, text: "openssl 1.1.1", want: true},
+		{terms: []string{"openssl"}, text: "OpenSSL 1.1.1", want: false},
+		{terms: []string{"nginx", "apache"}, text: "an apache httpd flaw", want: true},
+		{terms: []string{"nginx", "apache"}, text: "lighttpd", want: false},
+		{terms: []string{"he", "she", "his", "hers"}, text: "ushers", want: true},
+		{terms: []string{"abcd", "bc"}, text: "abce", want: true},
+		{terms: []string{"abcd", "bcx"}, text: "abcx", want: true},
+		{terms: []string{"aab"}, text: "aaab", want: true},
+		{terms: []string{"abab"}, text: "abaabab", want: true},
+		{terms: []string{"abc"}, text: "ab", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := newLiteralSet(tt.terms).containsAny(tt.text); got != tt.want {
+			t.Errorf("newLiteralSet(%q).containsAny(%q) = %t, want %t", tt.terms, tt.text, got, tt.want)
+		}
+
+		// the automaton must agree with searching for each term in turn
+		naive := false
+		for _, term := range tt.terms {
+			naive = naive || strings.Contains(tt.text, term)
+		}
+		if naive != tt.want {
+			t.Errorf("strings.Contains disagrees for %q in %q", tt.terms, tt.text)
+		}
+	}
+}
+
+// benchmarkFixture returns the terms of 500 filters and the titles of 5000
+// items, half of which match one of the filters.
+func benchmarkFixture() ([]string, []string) {
+	terms := make([]string, 500)
+	for i := range terms {
+		terms[i] = fmt.Sprintf("prod%03d_lib", i)
+	}
+
+	titles := make([]string, 5000)
+	for i := range titles {
+		titles[i] = fmt.Sprintf("CVE-2021-%05d (vendor%02d, prod%03d_lib)", i, i%97, i%1000)
+	}
+
+	return terms, titles
+}
+
+func BenchmarkLiteralSet(b *testing.B) {
+	terms, titles := benchmarkFixture()
+	set := newLiteralSet(terms)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, title := range titles {
+			set.containsAny(title)
+		}
+	}
+}
+
+func BenchmarkContainsLoop(b *testing.B) {
+	terms, titles := benchmarkFixture()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, title := range titles {
+			for _, term := range terms {
+				if strings.Contains(title, term) {
+					break
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkAnyMatcher(b *testing.B) {
+	terms, titles := benchmarkFixture()
+	groups := make(map[string][]string, len(terms))
+	for _, term := range terms {
+		groups[term] = []string{term}
+	}
+	matcher := NewAnyMatcher(Build(groups, nil, ""))
+
+	items := make([]*rss.Item, len(titles))
+	for i, title := range titles {
+		items[i] = &rss.Item{Title: title}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, item := range items {
+			matcher.Matches(item)
+		}
+	}
+}
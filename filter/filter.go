@@ -0,0 +1,230 @@
+// Package filter loads the filter directories of sec-feed and matches feed
+// items against the filters read from them, so the matching can be reused
+// outside of the sec-feed command.
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/SlyMarbo/rss"
+)
+
+// Matcher decides whether an item is selected.
+type Matcher interface {
+	Matches(item *rss.Item) bool
+}
+
+// Filter is a named matcher loaded from the filter directory. Name is the
+// filter's file or group directory name, while Label is the name shown in
+// notifications, stats and generated pages.
+type Filter struct {
+	Name  string
+	Label string
+	Matcher
+}
+
+// SubstringMatcher matches items whose title contains Term.
+type SubstringMatcher struct {
+	Term string
+}
+
+func (m SubstringMatcher) Matches(item *rss.Item) bool {
+	return strings.Contains(item.Title, m.Term)
+}
+
+// AllMatcher matches items matched by every one of its matchers. An empty
+// AllMatcher matches nothing.
+type AllMatcher []Matcher
+
+func (m AllMatcher) Matches(item *rss.Item) bool {
+	for _, matcher := range m {
+		if !matcher.Matches(item) {
+			return false
+		}
+	}
+
+	return len(m) > 0
+}
+
+// Build converts the filter groups read from the filter directory into
+// filters sorted by name, each matching items matched by every term of its
+// group. Glob terms match the tags of titles split on tagSeparator. See
+// NewTermMatcher and Label.
+func Build(groups map[string][]string, labels map[string]string, tagSeparator string) []Filter {
+	filters := make([]Filter, 0, len(groups))
+	for name, terms := range groups {
+		if len(terms) == 1 {
+			filters = append(filters, Filter{Name: name, Label: Label(name, labels), Matcher: NewTermMatcher(terms[0], tagSeparator)})
+			continue
+		}
+
+		var matcher AllMatcher
+		for _, term := range terms {
+			matcher = append(matcher, NewTermMatcher(term, tagSeparator))
+		}
+
+		filters = append(filters, Filter{Name: name, Label: Label(name, labels), Matcher: matcher})
+	}
+
+	sort.Slice(filters, func(i, j int) bool {
+		return filters[i].Name < filters[j].Name
+	})
+
+	return filters
+}
+
+// Label returns the label of the named filter from labels, keyed by the
+// name with or without its extension, falling back to the name without its
+// extension so log4shell.txt is labelled log4shell.
+func Label(name string, labels map[string]string) string {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	if base == "" {
+		base = name
+	}
+
+	if label, ok := labels[name]; ok {
+		return label
+	} else if label, ok := labels[base]; ok {
+		return label
+	}
+
+	return base
+}
+
+// LoadLabels reads a file of name=label lines giving filters friendly
+// labels. Blank lines and lines starting with # are ignored.
+func LoadLabels(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	labels := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		name, label, ok := strings.Cut(text, "=")
+		name, label = strings.TrimSpace(name), strings.TrimSpace(label)
+		if !ok || name == "" || label == "" {
+			return nil, fmt.Errorf("%s:%d: expected name=label", path, line)
+		}
+
+		labels[name] = label
+	}
+
+	return labels, scanner.Err()
+}
+
+// AnyMatcher matches items matched by any of its filters. Plain substring
+// filters are compiled into a single automaton so their cost doesn't grow
+// with the number of filters, while all other filters are tried in turn.
+type AnyMatcher struct {
+	literals *literalSet
+	others   []Filter
+}
+
+// NewAnyMatcher returns the matcher of items matched by any of filters.
+func NewAnyMatcher(filters []Filter) AnyMatcher {
+	var m AnyMatcher
+	var terms []string
+
+	for _, filter := range filters {
+		if sub, ok := filter.Matcher.(SubstringMatcher); ok {
+			terms = append(terms, sub.Term)
+		} else {
+			m.others = append(m.others, filter)
+		}
+	}
+
+	if len(terms) > 0 {
+		m.literals = newLiteralSet(terms)
+	}
+
+	return m
+}
+
+func (m AnyMatcher) Matches(item *rss.Item) bool {
+	if m.literals != nil && m.literals.containsAny(item.Title) {
+		return true
+	}
+
+	return MatchesAny(item, m.others)
+}
+
+// Find returns the filter with the given name or, failing that, the filter
+// whose label or name without its extension is name, so log4shell finds
+// log4shell.txt. It returns an error when no filter, or more than one, has
+// that label or name without its extension.
+func Find(filters []Filter, name string) (Filter, error) {
+	var found []Filter
+	for _, filter := range filters {
+		if filter.Name == name {
+			return filter, nil
+		}
+
+		if filter.Label == name || strings.TrimSuffix(filter.Name, filepath.Ext(filter.Name)) == name {
+			found = append(found, filter)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return Filter{}, fmt.Errorf("no filter is named or labelled %s", name)
+	case 1:
+		return found[0], nil
+	}
+
+	names := make([]string, len(found))
+	for i, filter := range found {
+		names[i] = filter.Name
+	}
+
+	return Filter{}, fmt.Errorf("%s may be any of the filters %s", name, strings.Join(names, ", "))
+}
+
+// MatchesAny returns true if any filter matches item.
+func MatchesAny(item *rss.Item, filters []Filter) bool {
+	for _, filter := range filters {
+		if filter.Matches(item) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchedLabels returns the labels of every filter matching item, in the
+// order of filters.
+func MatchedLabels(item *rss.Item, filters []Filter) []string {
+	var labels []string
+	for _, filter := range filters {
+		if filter.Matches(item) {
+			labels = append(labels, filter.Label)
+		}
+	}
+
+	return labels
+}
+
+// MatchedNames returns the names of every filter matching item, in the
+// order of filters.
+func MatchedNames(item *rss.Item, filters []Filter) []string {
+	var names []string
+	for _, filter := range filters {
+		if filter.Matches(item) {
+			names = append(names, filter.Name)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,272 @@
+package filter
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/SlyMarbo/rss"
+)
+
+func TestSubstringMatcher(t *testing.T) {
+	tests := []struct {
+		term  string
+		title string
+		want  bool
+	}{
+		{term: "openssl", title: "CVE-2021-0001 (openssl)", want: true},
+		{term: "OpenSSL", title: "CVE-2021-0001 (openssl)", want: false},
+		{term: "CVE-2021", title: "CVE-2021-0001 (openssl)", want: true},
+		{term: "nginx", title: "CVE-2021-0001 (openssl)", want: false},
+		{term: "openssl", title: "", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := (SubstringMatcher{Term: tt.term}).Matches(&rss.Item{Title: tt.title}); got != tt.want {
+			t.Errorf("SubstringMatcher{%q}.Matches(%q) = %t, want %t", tt.term, tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestAllMatcher(t *testing.T) {
+	item := &rss.Item{Title: "CVE-2021-0001 (openssl, debian)"}
+
+	tests := []struct {
+		name    string
+		matcher AllMatcher
+		want    bool
+	}{
+		{name: "empty", matcher: AllMatcher{}, want: false},
+		{name: "nil", matcher: nil, want: false},
+		{name: "every term", matcher: AllMatcher{SubstringMatcher{"openssl"}, SubstringMatcher{"debian"}}, want: true},
+		{name: "one term missing", matcher: AllMatcher{SubstringMatcher{"openssl"}, SubstringMatcher{"fedora"}}, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.matcher.Matches(item); got != tt.want {
+			t.Errorf("%s: AllMatcher.Matches() = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	groups := map[string][]string{
+		"wireshark.txt": {"wireshark"},
+		"debian-ssl":    {"openssl", "debian*"},
+		"kernel":        {"linux_kernel"},
+	}
+	filters := Build(groups, map[string]string{"kernel": "Linux"}, "")
+
+	var names, labels []string
+	for _, f := range filters {
+		names = append(names, f.Name)
+		labels = append(labels, f.Label)
+	}
+
+	if want := []string{"debian-ssl", "kernel", "wireshark.txt"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Build() names = %q, want %q sorted by name", names, want)
+	}
+
+	if want := []string{"debian-ssl", "Linux", "wireshark"}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("Build() labels = %q, want %q", labels, want)
+	}
+
+	tests := []struct {
+		title string
+		want  []string
+	}{
+		{title: "CVE-2021-0001 (openssl, debian_linux)", want: []string{"debian-ssl"}},
+		{title: "CVE-2021-0002 (openssl, fedora)", want: nil},
+		{title: "CVE-2021-0003 (debian_linux)", want: nil},
+		{title: "CVE-2021-0004 (wireshark, debian_linux, openssl)", want: []string{"debian-ssl", "wireshark.txt"}},
+		{title: "CVE-2021-0005 (linux_kernel)", want: []string{"kernel"}},
+	}
+
+	for _, tt := range tests {
+		if got := MatchedNames(&rss.Item{Title: tt.title}, filters); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("MatchedNames(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestAnyMatcher(t *testing.T) {
+	mixed := Build(map[string][]string{
+		"literal": {"openssl"},
+		"glob":    {"ubuntu_*"},
+		"group":   {"wireshark", "debian"},
+	}, nil, "")
+
+	tests := []struct {
+		name    string
+		filters []Filter
+		title   string
+		want    bool
+	}{
+		{name: "no filters", filters: nil, title: "CVE-2021-0001 (openssl)", want: false},
+		{name: "empty filters", filters: []Filter{}, title: "CVE-2021-0001 (openssl)", want: false},
+		{name: "literal", filters: mixed, title: "CVE-2021-0001 (openssl)", want: true},
+		{name: "glob", filters: mixed, title: "CVE-2021-0002 (ubuntu_linux)", want: true},
+		{name: "group", filters: mixed, title: "CVE-2021-0003 (wireshark, debian)", want: true},
+		{name: "partial group", filters: mixed, title: "CVE-2021-0004 (wireshark)", want: false},
+		{name: "no match", filters: mixed, title: "CVE-2021-0005 (nginx)", want: false},
+		{name: "literal and glob", filters: mixed, title: "CVE-2021-0006 (openssl, ubuntu_linux)", want: true},
+	}
+
+	for _, tt := range tests {
+		item := &rss.Item{Title: tt.title}
+		if got := NewAnyMatcher(tt.filters).Matches(item); got != tt.want {
+			t.Errorf("%s: NewAnyMatcher().Matches(%q) = %t, want %t", tt.name, tt.title, got, tt.want)
+		}
+
+		// the automaton must agree with trying every filter in turn
+		if got := MatchesAny(item, tt.filters); got != tt.want {
+			t.Errorf("%s: MatchesAny(%q) = %t, want %t", tt.name, tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestMatchedNamesAndLabels(t *testing.T) {
+	// overlapping filters, given out of name order
+	filters := []Filter{
+		{Name: "ssl.txt", Label: "ssl", Matcher: SubstringMatcher{"ssl"}},
+		{Name: "openssl.txt", Label: "OpenSSL", Matcher: SubstringMatcher{"openssl"}},
+		{Name: "cve.txt", Label: "cve", Matcher: SubstringMatcher{"CVE-"}},
+	}
+
+	tests := []struct {
+		title      string
+		wantNames  []string
+		wantLabels []string
+	}{
+		{title: "CVE-2021-0001 (openssl)", wantNames: []string{"ssl.txt", "openssl.txt", "cve.txt"}, wantLabels: []string{"ssl", "OpenSSL", "cve"}},
+		{title: "CVE-2021-0002 (gnutls)", wantNames: []string{"cve.txt"}, wantLabels: []string{"cve"}},
+		{title: "libressl advisory", wantNames: []string{"ssl.txt"}, wantLabels: []string{"ssl"}},
+		{title: "nginx advisory", wantNames: nil, wantLabels: nil},
+	}
+
+	for _, tt := range tests {
+		item := &rss.Item{Title: tt.title}
+		if got := MatchedNames(item, filters); !reflect.DeepEqual(got, tt.wantNames) {
+			t.Errorf("MatchedNames(%q) = %q, want %q", tt.title, got, tt.wantNames)
+		}
+
+		if got := MatchedLabels(item, filters); !reflect.DeepEqual(got, tt.wantLabels) {
+			t.Errorf("MatchedLabels(%q) = %q, want %q", tt.title, got, tt.wantLabels)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	filters := Build(map[string][]string{
+		"log4shell.txt": {"log4j"},
+		"linux-rce":     {"linux_kernel"},
+		"ssl.txt":       {"openssl"},
+		"ssl":           {"libressl"},
+		"gnutls.txt":    {"gnutls"},
+		"nss.txt":       {"nss"},
+	}, map[string]string{"log4shell": "Apache Log4j", "gnutls.txt": "TLS", "nss": "TLS"}, "")
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "log4shell.txt", want: "log4shell.txt"},
+		{name: "log4shell", want: "log4shell.txt"},
+		{name: "Apache Log4j", want: "log4shell.txt"},
+		{name: "linux-rce", want: "linux-rce"},
+		// an exact name wins over another filter's name without its extension
+		{name: "ssl", want: "ssl"},
+		{name: "ssl.txt", want: "ssl.txt"},
+		{name: "TLS", wantErr: true},
+		{name: "log4j", wantErr: true},
+		{name: "LOG4SHELL", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		f, err := Find(filters, tt.name)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Find(%q) = %s, want an error", tt.name, f.Name)
+			}
+			continue
+		}
+
+		if err != nil || f.Name != tt.want {
+			t.Errorf("Find(%q) = %s, %v, want %s", tt.name, f.Name, err, tt.want)
+		}
+	}
+}
+
+func TestLabel(t *testing.T) {
+	labels := map[string]string{
+		"log4shell":      "Apache Log4j",
+		"linux-rce.txt":  "Linux remote code execution",
+		"linux-rce":      "unused",
+		"debian-ssl.txt": "Debian OpenSSL",
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "log4shell.txt", want: "Apache Log4j"},
+		{name: "log4shell", want: "Apache Log4j"},
+		// the name with its extension wins over the name without
+		{name: "linux-rce.txt", want: "Linux remote code execution"},
+		{name: "debian-ssl", want: "debian-ssl"},
+		{name: "wireshark.txt", want: "wireshark"},
+		{name: "openssl.v3.txt", want: "openssl.v3"},
+		{name: "kernel", want: "kernel"},
+		{name: ".txt", want: ".txt"},
+	}
+
+	for _, tt := range tests {
+		if got := Label(tt.name, labels); got != tt.want {
+			t.Errorf("Label(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if got := Label("log4shell.txt", nil); got != "log4shell" {
+		t.Errorf("Label(%q) without labels = %q, want %q", "log4shell.txt", got, "log4shell")
+	}
+}
+
+func TestLoadLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "labels",
+			data: "# labels\n\nlog4shell=Apache Log4j\n  linux-rce.txt = Linux RCE  \nurl=a=b\n",
+			want: map[string]string{"log4shell": "Apache Log4j", "linux-rce.txt": "Linux RCE", "url": "a=b"},
+		},
+		{name: "empty", data: "", want: map[string]string{}},
+		{name: "missing separator", data: "log4shell\n", wantErr: true},
+		{name: "missing label", data: "log4shell=\n", wantErr: true},
+		{name: "missing name", data: "=Apache Log4j\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "labels")
+		if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := LoadLabels(path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: LoadLabels() error = %v, want error %t", tt.name, err, tt.wantErr)
+		} else if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: LoadLabels() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := LoadLabels(filepath.Join(t.TempDir(), "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadLabels() of a missing file error = %v, want os.ErrNotExist", err)
+	}
+}
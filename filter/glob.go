@@ -0,0 +1,107 @@
+package filter
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/SlyMarbo/rss"
+)
+
+// DefaultTagSeparator separates the parenthetical tags of NVD style titles.
+const DefaultTagSeparator string = ", "
+
+// GlobMatcher matches items whose whole title, or any one of its
+// parenthetical tags split on TagSeparator, matches a glob pattern.
+type GlobMatcher struct {
+	Term         string
+	Pattern      *regexp.Regexp
+	TagSeparator string
+}
+
+func (m GlobMatcher) Matches(item *rss.Item) bool {
+	if m.Pattern.MatchString(item.Title) {
+		return true
+	}
+
+	for _, tag := range TitleTags(item.Title, m.TagSeparator) {
+		if m.Pattern.MatchString(tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewTermMatcher returns the matcher for a single filter term. Terms
+// containing an unescaped * or ? are globs, where * matches any run of
+// characters and ? any single character, and a backslash escapes the
+// character following it. All other terms are matched as substrings, with
+// escaped wildcards taken literally.
+func NewTermMatcher(term, tagSeparator string) Matcher {
+	if !strings.ContainsAny(term, "*?") {
+		return SubstringMatcher{Term: term}
+	}
+
+	var sb strings.Builder
+	var literal strings.Builder
+	glob := false
+
+	sb.WriteString(`(?s)^`)
+	for i := 0; i < len(term); i++ {
+		switch c := term[i]; {
+		case c == '\\' && i+1 < len(term) && strings.IndexByte(`*?\`, term[i+1]) >= 0:
+			i++
+			sb.WriteString(regexp.QuoteMeta(term[i : i+1]))
+			literal.WriteByte(term[i])
+		case c == '*':
+			glob = true
+			sb.WriteString(`.*`)
+		case c == '?':
+			glob = true
+			sb.WriteString(`.`)
+		default:
+			sb.WriteString(regexp.QuoteMeta(term[i : i+1]))
+			literal.WriteByte(c)
+		}
+	}
+	sb.WriteString(`$`)
+
+	if !glob {
+		return SubstringMatcher{Term: literal.String()}
+	}
+
+	return GlobMatcher{Term: term, Pattern: regexp.MustCompile(sb.String()), TagSeparator: tagSeparator}
+}
+
+// TitleTags returns the parenthetical tags of an NVD style title,
+// "CVE-YYYY-NNNN (tag, tag)", split on sep or DefaultTagSeparator when sep
+// is empty.
+func TitleTags(title, sep string) []string {
+	raw := RawTitleTags(title)
+	if raw == "" {
+		return nil
+	}
+
+	if sep == "" {
+		sep = DefaultTagSeparator
+	}
+
+	var tags []string
+	for _, tag := range strings.Split(raw, sep) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// RawTitleTags returns the unparsed parenthetical tag group of a title.
+func RawTitleTags(title string) string {
+	tmp := strings.SplitN(title, "(", 2)
+	if len(tmp) < 2 {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.Trim(tmp[1], "()"))
+}
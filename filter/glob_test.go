@@ -0,0 +1,87 @@
+package filter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/SlyMarbo/rss"
+)
+
+func TestNewTermMatcher(t *testing.T) {
+	tests := []struct {
+		term     string
+		title    string
+		want     bool
+		wantGlob bool
+	}{
+		{term: "openssl", title: "CVE-2020-1 (openssl)", want: true},
+		{term: "openssl", title: "CVE-2020-1 (gnutls)", want: false},
+		{term: "CVE-2020-*", title: "CVE-2020-1234 (openssl)", want: true, wantGlob: true},
+		{term: "CVE-2021-*", title: "CVE-2020-1234 (openssl)", want: false, wantGlob: true},
+		{term: "open*", title: "CVE-2020-1 (openssl)", want: true, wantGlob: true},
+		{term: "open*", title: "CVE-2020-1 (libopenssl)", want: false, wantGlob: true},
+		{term: "linux_?ernel", title: "CVE-2020-1 (linux_kernel, debian)", want: true, wantGlob: true},
+		{term: "linux_?ernel", title: "CVE-2020-1 (linux__ernel)", want: true, wantGlob: true},
+		{term: "linux_?ernel", title: "CVE-2020-1 (linux_ernel)", want: false, wantGlob: true},
+		{term: "a.b*", title: "CVE-2020-1 (axb)", want: false, wantGlob: true},
+		{term: `what\?`, title: "CVE-2020-1 what? (x)", want: true},
+		{term: `what\?`, title: "CVE-2020-1 whats (x)", want: false},
+		{term: `star\*`, title: "CVE-2020-1 star* (x)", want: true},
+		{term: `back\\*`, title: `CVE-2020-1 (back\slash)`, want: true, wantGlob: true},
+	}
+
+	for _, tt := range tests {
+		m := NewTermMatcher(tt.term, DefaultTagSeparator)
+		if _, ok := m.(GlobMatcher); ok != tt.wantGlob {
+			t.Errorf("NewTermMatcher(%q) is a glob: %t, want %t", tt.term, ok, tt.wantGlob)
+		}
+
+		if got := m.Matches(&rss.Item{Title: tt.title}); got != tt.want {
+			t.Errorf("NewTermMatcher(%q).Matches(%q) = %t, want %t", tt.term, tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestTitleTags(t *testing.T) {
+	tests := []struct {
+		title string
+		sep   string
+		want  []string
+	}{
+		{title: "CVE-2021-0001 (openssl, debian_linux)", sep: "", want: []string{"openssl", "debian_linux"}},
+		{title: "CVE-2021-0001 (openssl, debian_linux)", sep: ", ", want: []string{"openssl", "debian_linux"}},
+		{title: "CVE-2021-0001 (openssl; debian_linux ;ubuntu)", sep: ";", want: []string{"openssl", "debian_linux", "ubuntu"}},
+		{title: "CVE-2021-0001 (openssl | debian_linux|ubuntu)", sep: "|", want: []string{"openssl", "debian_linux", "ubuntu"}},
+		{title: "CVE-2021-0001 (openssl  debian_linux)", sep: " ", want: []string{"openssl", "debian_linux"}},
+		{title: "CVE-2021-0001 (openssl;;debian_linux;)", sep: ";", want: []string{"openssl", "debian_linux"}},
+		{title: "CVE-2021-0001 (openssl; debian_linux)", sep: ", ", want: []string{"openssl; debian_linux"}},
+		{title: "CVE-2021-0001 ()", sep: ";", want: nil},
+		{title: "CVE-2021-0001", sep: ";", want: nil},
+	}
+
+	for _, tt := range tests {
+		if got := TitleTags(tt.title, tt.sep); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("TitleTags(%q, %q) = %q, want %q", tt.title, tt.sep, got, tt.want)
+		}
+	}
+}
+
+func TestGlobMatcherTagSeparator(t *testing.T) {
+	tests := []struct {
+		sep   string
+		title string
+		want  bool
+	}{
+		{sep: ";", title: "CVE-2021-0001 (openssl;debian_linux)", want: true},
+		{sep: "|", title: "CVE-2021-0001 (openssl | debian_linux)", want: true},
+		{sep: ", ", title: "CVE-2021-0001 (openssl;debian_linux)", want: false},
+		{sep: ";", title: "CVE-2021-0001 (openssl;ubuntu_linux)", want: false},
+	}
+
+	for _, tt := range tests {
+		m := NewTermMatcher("debian_*", tt.sep)
+		if got := m.Matches(&rss.Item{Title: tt.title}); got != tt.want {
+			t.Errorf("debian_* with separator %q: Matches(%q) = %t, want %t", tt.sep, tt.title, got, tt.want)
+		}
+	}
+}
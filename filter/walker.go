@@ -0,0 +1,264 @@
+package filter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MaxLineLength bounds the length of a line read from a filter file, well
+// beyond any plausible filter term.
+const MaxLineLength int = 1024 * 1024
+
+// ErrEmptyFile is returned for filter files without a non-empty line.
+type ErrEmptyFile struct {
+	file string
+}
+
+func (e *ErrEmptyFile) Error() string {
+	return fmt.Sprintf("file %s is empty", e.file)
+}
+
+// ErrDirNotFound is returned when the filter directory doesn't exist,
+// commonly a mistyped -filter-path.
+type ErrDirNotFound struct {
+	dir string
+}
+
+func (e *ErrDirNotFound) Error() string {
+	return fmt.Sprintf("filter directory %s not found", e.dir)
+}
+
+// ErrLineTooLong is returned for filter files containing a line longer than
+// MaxLineLength before their first non-empty line ends.
+type ErrLineTooLong struct {
+	file string
+}
+
+func (e *ErrLineTooLong) Error() string {
+	return fmt.Sprintf("file %s has a line longer than %d bytes", e.file, MaxLineLength)
+}
+
+// WalkOptions controls how filter directories are read.
+type WalkOptions struct {
+	// AllowMissing skips directories that don't exist with a warning.
+	AllowMissing bool
+
+	// Warnf and Verbosef, when set, receive warnings about the filters read
+	// and details of how directories were merged.
+	Warnf    func(format string, v ...interface{})
+	Verbosef func(format string, v ...interface{})
+}
+
+func (o WalkOptions) warnf(format string, v ...interface{}) {
+	if o.Warnf != nil {
+		o.Warnf(format, v...)
+	}
+}
+
+func (o WalkOptions) verbosef(format string, v ...interface{}) {
+	if o.Verbosef != nil {
+		o.Verbosef(format, v...)
+	}
+}
+
+// readLine reads up to and including the next newline from r, returning
+// ErrLineTooLong once the line exceeds MaxLineLength.
+func readLine(r *bufio.Reader, path string) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > MaxLineLength {
+			return "", &ErrLineTooLong{file: path}
+		}
+
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return string(line), err
+		}
+	}
+}
+
+// firstNonEmptyLine returns the first line of the file at path containing
+// anything but whitespace, skipping comment lines starting with #, with any
+// surrounding whitespace trimmed. It reads through r so a single buffer is
+// reused across every filter file, and supports lines up to MaxLineLength.
+func firstNonEmptyLine(r *bufio.Reader, path string, opts WalkOptions) (string, error) {
+	readFile, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer readFile.Close()
+
+	r.Reset(readFile)
+	for {
+		lineText, err := readLine(r, path)
+		if trimmed := strings.TrimSpace(lineText); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			if lineText = strings.TrimRight(lineText, "\r\n"); lineText != trimmed {
+				opts.warnf("filter %q in %s has surrounding whitespace, matching on %q", lineText, path, trimmed)
+			}
+
+			return trimmed, nil
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return "", err
+		}
+	}
+
+	return "", &ErrEmptyFile{
+		file: path,
+	}
+}
+
+// disabledSuffix and disabledPrefix mark filter files and group directories
+// that are skipped without being deleted.
+const (
+	disabledSuffix string = ".disabled"
+	disabledPrefix string = "_"
+)
+
+// isDisabledName reports whether a filter file or group directory name is
+// marked disabled.
+func isDisabledName(name string) bool {
+	return strings.HasPrefix(name, disabledPrefix) || strings.HasSuffix(name, disabledSuffix)
+}
+
+// enabledName returns a filter name without its disabled marker.
+func enabledName(name string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(name, disabledPrefix), disabledSuffix)
+}
+
+// isDisabledHeader reports whether the first line of a filter file is a
+// "disabled: true" header.
+func isDisabledHeader(line string) bool {
+	key, value, ok := strings.Cut(line, ":")
+	return ok && strings.EqualFold(strings.TrimSpace(key), "disabled") && strings.EqualFold(strings.TrimSpace(value), "true")
+}
+
+// WalkDirs merges the filter sets of several filter directories, where a
+// filter in a later directory replaces, or disables, one of the same name
+// from an earlier directory. It returns the merged filters along with the
+// sorted names of the disabled filters.
+func WalkDirs(dirs []string, opts WalkOptions) (map[string][]string, []string, error) {
+	filters := make(map[string][]string)
+	disabled := make(map[string]bool)
+	sources := make(map[string]string)
+
+	for _, dir := range dirs {
+		groups, dirDisabled, err := WalkDir(dir, opts)
+		var notFound *ErrDirNotFound
+		if errors.As(err, &notFound) && opts.AllowMissing {
+			opts.warnf("%s, continuing without its filters", err)
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		for name, terms := range groups {
+			if source, ok := sources[name]; ok {
+				opts.verbosef("filter %s in %s replaces the filter of the same name in %s", name, dir, source)
+			}
+
+			filters[name] = terms
+			delete(disabled, name)
+			sources[name] = dir
+		}
+
+		for _, name := range dirDisabled {
+			if source, ok := sources[name]; ok {
+				opts.verbosef("filter %s is disabled in %s, replacing the filter of the same name in %s", name, dir, source)
+			}
+
+			delete(filters, name)
+			disabled[name] = true
+			sources[name] = dir
+		}
+	}
+
+	return filters, sortedKeys(disabled), nil
+}
+
+// WalkDir builds the filter set from the files in dir. Each
+// file at the top level of dir is a filter group of its own, while all files
+// below a subdirectory are combined into a single group named after that
+// subdirectory. Files and directories named with a leading _ or a .disabled
+// extension, and files starting with a "disabled: true" header, disable
+// their filter or whole group, whose names are returned sorted.
+func WalkDir(dir string, opts WalkOptions) (map[string][]string, []string, error) {
+	info, err := os.Stat(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, &ErrDirNotFound{dir: dir}
+	} else if err != nil {
+		return nil, nil, err
+	} else if !info.IsDir() {
+		return nil, nil, fmt.Errorf("filter path %s is not a directory", dir)
+	}
+
+	filters := make(map[string][]string)
+	disabled := make(map[string]bool)
+	reader := bufio.NewReader(nil)
+
+	err = filepath.WalkDir(dir, func(path string, d os.DirEntry, e error) error {
+		if e != nil {
+			return e
+		} else if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		parts := strings.Split(rel, string(filepath.Separator))
+		name := enabledName(parts[0])
+		for _, part := range parts {
+			if isDisabledName(part) {
+				disabled[name] = true
+				return nil
+			}
+		}
+
+		filter, err := firstNonEmptyLine(reader, path, opts)
+		if err != nil || len(filter) == 0 {
+			return err
+		}
+
+		if isDisabledHeader(filter) {
+			disabled[name] = true
+			return nil
+		}
+
+		filters[name] = append(filters[name], filter)
+		return nil
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// a disabled file disables its whole group rather than broadening it
+	for name := range disabled {
+		delete(filters, name)
+	}
+
+	return filters, sortedKeys(disabled), nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
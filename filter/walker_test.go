@@ -0,0 +1,288 @@
+package filter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFilterDir writes n filter files to dir, every tenth one in a group
+// directory of its own.
+func writeFilterDir(tb testing.TB, dir string, n int) {
+	for i := 0; i < n; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("prod%03d.txt", i))
+		if i%10 == 0 {
+			path = filepath.Join(dir, fmt.Sprintf("group%03d", i), "term.txt")
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			tb.Fatal(err)
+		}
+
+		data := fmt.Sprintf("# filter %d\n\nprod%03d_lib\n", i, i)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWalkDir(b *testing.B) {
+	dir := b.TempDir()
+	writeFilterDir(b, dir, 500)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		groups, _, err := WalkDir(dir, WalkOptions{})
+		if err != nil {
+			b.Fatal(err)
+		} else if len(groups) != 500 {
+			b.Fatalf("WalkDir() read %d filters, want 500", len(groups))
+		}
+	}
+}
+
+// writeFilterFile writes a filter file holding data to dir, returning its
+// path.
+func writeFilterFile(tb testing.TB, dir, name, data string) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		tb.Fatal(err)
+	}
+
+	return path
+}
+
+func TestFirstNonEmptyLineReusedReader(t *testing.T) {
+	dir := t.TempDir()
+	long := strings.Repeat("a", 100*1024)
+
+	// a long file read first must not leave its tail for the next file
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "long.txt", data: long + "\nsecond\n", want: long},
+		{name: "short.txt", data: "openssl\n", want: "openssl"},
+		{name: "blank-lines.txt", data: "\n\n\nnginx", want: "nginx"},
+		{name: "long-tail.txt", data: "debian\n" + long, want: "debian"},
+		{name: "after-tail.txt", data: "gnutls\n", want: "gnutls"},
+	}
+
+	reader := bufio.NewReader(nil)
+	for _, tt := range tests {
+		path := writeFilterFile(t, dir, tt.name, tt.data)
+		if got, err := firstNonEmptyLine(reader, path, WalkOptions{}); err != nil || got != tt.want {
+			t.Errorf("firstNonEmptyLine(%s) = %.20q, %v, want %.20q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestReadLineLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    int
+		tooLong bool
+	}{
+		{name: "100KB line", data: strings.Repeat("a", 100*1024) + "\n", want: 100*1024 + 1},
+		{name: "longest line", data: strings.Repeat("a", MaxLineLength-1) + "\n", want: MaxLineLength},
+		{name: "longest line at EOF", data: strings.Repeat("a", MaxLineLength), want: MaxLineLength},
+		{name: "line too long", data: strings.Repeat("a", MaxLineLength) + "\n", tooLong: true},
+		{name: "line too long at EOF", data: strings.Repeat("a", MaxLineLength+1), tooLong: true},
+	}
+
+	for _, tt := range tests {
+		line, err := readLine(bufio.NewReader(strings.NewReader(tt.data)), "filter.txt")
+		var tooLong *ErrLineTooLong
+		if got := errors.As(err, &tooLong); got != tt.tooLong {
+			t.Errorf("%s: readLine() error = %v, want ErrLineTooLong %t", tt.name, err, tt.tooLong)
+			continue
+		}
+
+		if !tt.tooLong && len(line) != tt.want {
+			t.Errorf("%s: readLine() read %d bytes, want %d", tt.name, len(line), tt.want)
+		}
+	}
+}
+
+func TestFirstNonEmptyLineTooLong(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		data     string
+		wantErr  interface{}
+		wantTerm string
+	}{
+		{name: "long.txt", data: strings.Repeat("a", MaxLineLength+1) + "\nopenssl\n", wantErr: new(*ErrLineTooLong)},
+		{name: "long-comment.txt", data: "#" + strings.Repeat("a", MaxLineLength) + "\nopenssl\n", wantErr: new(*ErrLineTooLong)},
+		{name: "empty.txt", data: "\n \n", wantErr: new(*ErrEmptyFile)},
+		// only lines read before the term are bounded
+		{name: "long-after.txt", data: "openssl\n" + strings.Repeat("a", MaxLineLength+1), wantTerm: "openssl"},
+	}
+
+	for _, tt := range tests {
+		path := writeFilterFile(t, dir, tt.name, tt.data)
+		term, err := firstNonEmptyLine(bufio.NewReader(nil), path, WalkOptions{})
+		if tt.wantErr == nil {
+			if err != nil || term != tt.wantTerm {
+				t.Errorf("firstNonEmptyLine(%s) = %q, %v, want %q", tt.name, term, err, tt.wantTerm)
+			}
+			continue
+		}
+
+		if !errors.As(err, tt.wantErr) {
+			t.Errorf("firstNonEmptyLine(%s) error = %v, want %T", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestFirstNonEmptyLineComments(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{name: "leading-comment.txt", data: "# tracks openssl advisories\nopenssl\n", want: "openssl"},
+		{name: "comments-and-blanks.txt", data: "\n# one\n\n  # indented\n\nnginx\n# after\n", want: "nginx"},
+		{name: "inline-hash.txt", data: "c# compiler\n", want: "c# compiler"},
+		{name: "only-comments.txt", data: "# nothing\n#to match\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		path := writeFilterFile(t, dir, tt.name, tt.data)
+		got, err := firstNonEmptyLine(bufio.NewReader(nil), path, WalkOptions{})
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("firstNonEmptyLine(%s) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestFirstNonEmptyLineTrimmed(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name string
+		data string
+		want string
+		warn bool
+	}{
+		{name: "clean.txt", data: "openssl\n", want: "openssl"},
+		{name: "crlf.txt", data: "openssl\r\n", want: "openssl"},
+		{name: "trailing.txt", data: "openssl \n", want: "openssl", warn: true},
+		{name: "leading.txt", data: "\topenssl\n", want: "openssl", warn: true},
+		{name: "inner.txt", data: "linux kernel\n", want: "linux kernel"},
+		{name: "no-newline.txt", data: " nginx", want: "nginx", warn: true},
+	}
+
+	for _, tt := range tests {
+		path := writeFilterFile(t, dir, tt.name, tt.data)
+		var warnings []string
+		opts := WalkOptions{Warnf: func(format string, v ...interface{}) {
+			warnings = append(warnings, fmt.Sprintf(format, v...))
+		}}
+
+		got, err := firstNonEmptyLine(bufio.NewReader(nil), path, opts)
+		if err != nil || got != tt.want {
+			t.Errorf("firstNonEmptyLine(%s) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+
+		if warned := len(warnings) > 0; warned != tt.warn {
+			t.Errorf("firstNonEmptyLine(%s) warnings = %q, want a warning %t", tt.name, warnings, tt.warn)
+		}
+	}
+}
+
+func TestDisabledNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		disabled bool
+		enabled  string
+	}{
+		{name: "openssl.txt", disabled: false, enabled: "openssl.txt"},
+		{name: "_openssl.txt", disabled: true, enabled: "openssl.txt"},
+		{name: "openssl.txt.disabled", disabled: true, enabled: "openssl.txt"},
+		{name: "_openssl.disabled", disabled: true, enabled: "openssl"},
+		{name: "open_ssl.txt", disabled: false, enabled: "open_ssl.txt"},
+		{name: "openssl.disabled.txt", disabled: false, enabled: "openssl.disabled.txt"},
+	}
+
+	for _, tt := range tests {
+		if got := isDisabledName(tt.name); got != tt.disabled {
+			t.Errorf("isDisabledName(%q) = %t, want %t", tt.name, got, tt.disabled)
+		}
+
+		if got := enabledName(tt.name); got != tt.enabled {
+			t.Errorf("enabledName(%q) = %q, want %q", tt.name, got, tt.enabled)
+		}
+	}
+}
+
+func TestIsDisabledHeader(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{line: "disabled: true", want: true},
+		{line: "Disabled:TRUE", want: true},
+		{line: " disabled :  true ", want: true},
+		{line: "disabled: false", want: false},
+		{line: "disabled", want: false},
+		{line: "disabled: truely", want: false},
+		{line: "openssl", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isDisabledHeader(tt.line); got != tt.want {
+			t.Errorf("isDisabledHeader(%q) = %t, want %t", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestWalkDirDisabled(t *testing.T) {
+	dir := t.TempDir()
+	for path, data := range map[string]string{
+		"openssl.txt":         "openssl\n",
+		"_nginx.txt":          "nginx\n",
+		"gnutls.txt.disabled": "gnutls\n",
+		"header.txt":          "disabled: true\nlibressl\n",
+		"debian/openssl.txt":  "openssl\n",
+		"debian/_kernel.txt":  "linux_kernel\n",
+		"_ubuntu/openssl.txt": "openssl\n",
+		"fedora/openssl.txt":  "openssl\n",
+		"fedora/systemd.txt":  "systemd\n",
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(path)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeFilterFile(t, dir, path, data)
+	}
+
+	groups, disabled, err := WalkDir(dir, WalkOptions{})
+	if err != nil {
+		t.Fatalf("WalkDir() error = %s", err)
+	}
+
+	want := map[string][]string{
+		"openssl.txt": {"openssl"},
+		"fedora":      {"openssl", "systemd"},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("WalkDir() filters = %q, want %q", groups, want)
+	}
+
+	// a disabled file disables its whole group
+	if wantDisabled := []string{"debian", "gnutls.txt", "header.txt", "nginx.txt", "ubuntu"}; !reflect.DeepEqual(disabled, wantDisabled) {
+		t.Errorf("WalkDir() disabled = %q, want %q", disabled, wantDisabled)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/SlyMarbo/rss"
+	"github.com/ncatelli/sec-feed/filter"
+)
+
+func TestParseCVSSValues(t *testing.T) {
+	tests := []struct {
+		spec    string
+		metric  string
+		want    map[string]bool
+		wantErr bool
+	}{
+		{spec: "", metric: "AV", want: map[string]bool{}},
+		{spec: "network", metric: "AV", want: map[string]bool{"network": true}},
+		{spec: " Network , ADJACENT,", metric: "AV", want: map[string]bool{"network": true, "adjacent": true}},
+		{spec: "none,low", metric: "PR", want: map[string]bool{"none": true, "low": true}},
+		{spec: "network", metric: "PR", wantErr: true},
+		{spec: "remote", metric: "AV", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseCVSSValues(tt.spec, tt.metric)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCVSSValues(%q, %q) error = %v, want error %t", tt.spec, tt.metric, err, tt.wantErr)
+			continue
+		}
+
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseCVSSValues(%q, %q) = %v, want %v", tt.spec, tt.metric, got, tt.want)
+		}
+	}
+}
+
+func TestLinkAllowed(t *testing.T) {
+	tests := []struct {
+		link  string
+		allow []string
+		deny  []string
+		want  bool
+	}{
+		{link: "https://example.com/a", want: true},
+		{link: "not a url", want: true},
+		{link: "https://nvd.nist.gov/vuln", allow: []string{"nist.gov"}, want: true},
+		{link: "https://NVD.NIST.GOV/vuln", allow: []string{".Nist.Gov"}, want: true},
+		{link: "https://example.com/a", allow: []string{"nist.gov"}, want: false},
+		{link: "https://evilnist.gov/a", allow: []string{"nist.gov"}, want: false},
+		{link: "/relative", allow: []string{"nist.gov"}, want: false},
+		{link: "/relative", deny: []string{"example.com"}, want: true},
+		{link: "https://cdn.example.com/a", deny: []string{"example.com"}, want: false},
+		{link: "https://example.org/a", deny: []string{"example.com"}, want: true},
+		{link: "https://mirror.nist.gov/a", allow: []string{"nist.gov"}, deny: []string{"mirror.nist.gov"}, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := linkAllowed(tt.link, tt.allow, tt.deny); got != tt.want {
+			t.Errorf("linkAllowed(%q, %q, %q) = %t, want %t", tt.link, tt.allow, tt.deny, got, tt.want)
+		}
+	}
+}
+
+func TestHostInDomain(t *testing.T) {
+	tests := []struct {
+		host   string
+		domain string
+		want   bool
+	}{
+		{host: "example.com", domain: "example.com", want: true},
+		{host: "www.example.com", domain: "example.com", want: true},
+		{host: "a.b.example.com", domain: ".example.com", want: true},
+		{host: "example.com", domain: "EXAMPLE.com", want: true},
+		{host: "notexample.com", domain: "example.com", want: false},
+		{host: "example.com.evil.org", domain: "example.com", want: false},
+		{host: "example.com", domain: "www.example.com", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := hostInDomain(tt.host, tt.domain); got != tt.want {
+			t.Errorf("hostInDomain(%q, %q) = %t, want %t", tt.host, tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestAgeMatcher(t *testing.T) {
+	now := time.Now()
+	cutoff := now.Add(-30 * 24 * time.Hour)
+
+	tests := []struct {
+		name        string
+		date        time.Time
+		keepUndated bool
+		want        bool
+	}{
+		{name: "recent", date: now.Add(-time.Hour), want: true},
+		{name: "decade old re-list", date: now.AddDate(-10, 0, 0), want: false},
+		{name: "at the cutoff", date: cutoff, want: false},
+		{name: "just after the cutoff", date: cutoff.Add(time.Second), want: true},
+		{name: "undated kept", keepUndated: true, want: true},
+		{name: "undated dropped", keepUndated: false, want: false},
+	}
+
+	for _, tt := range tests {
+		m := ageMatcher{cutoff: cutoff, keepUndated: tt.keepUndated}
+		if got := m.Matches(&rss.Item{Title: "CVE-2021-0001", Date: tt.date}); got != tt.want {
+			t.Errorf("%s: ageMatcher.Matches() = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestItemSelectorMaxAge(t *testing.T) {
+	prevAge, prevUndated := maxAge, keepUndated
+	maxAge, keepUndated = 30*24*time.Hour, true
+	t.Cleanup(func() { maxAge, keepUndated = prevAge, prevUndated })
+
+	filters := filter.Build(map[string][]string{"openssl": {"openssl"}}, nil, "")
+	selector := newItemSelector(filters)
+
+	tests := []struct {
+		item *rss.Item
+		want bool
+	}{
+		{item: &rss.Item{Title: "CVE-2021-0001 (openssl)", Date: time.Now()}, want: true},
+		{item: &rss.Item{Title: "CVE-2011-0001 (openssl)", Date: time.Now().AddDate(-10, 0, 0)}, want: false},
+		{item: &rss.Item{Title: "CVE-2021-0002 (openssl)"}, want: true},
+		{item: &rss.Item{Title: "CVE-2021-0003 (nginx)", Date: time.Now()}, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := selector.Matches(tt.item); got != tt.want {
+			t.Errorf("selector.Matches(%q) = %t, want %t", tt.item.Title, got, tt.want)
+		}
+	}
+}
+
+func TestLinkMatcher(t *testing.T) {
+	m := linkMatcher{pattern: regexp.MustCompile(`redhat\.com/security/cve/`)}
+
+	tests := []struct {
+		link string
+		want bool
+	}{
+		{link: "https://access.redhat.com/security/cve/CVE-2021-0001", want: true},
+		{link: "https://www.redhat.com/security/cve/cve-2021-0001", want: true},
+		{link: "https://nvd.nist.gov/vuln/detail/CVE-2021-0001", want: false},
+		{link: "https://security.debian.org/CVE-2021-0001", want: false},
+		{link: "https://access.redhat.com/errata/RHSA-2021:0001", want: false},
+		// only absolute urls match, however the text reads
+		{link: "redhat.com/security/cve/CVE-2021-0001", want: false},
+		{link: "http://[::1/redhat.com/security/cve/", want: false},
+		{link: "", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := m.Matches(&rss.Item{Title: "CVE-2021-0001", Link: tt.link}); got != tt.want {
+			t.Errorf("linkMatcher.Matches(%q) = %t, want %t", tt.link, got, tt.want)
+		}
+	}
+}
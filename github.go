@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/SlyMarbo/rss"
+	"github.com/ncatelli/sec-feed/filter"
+)
+
+const (
+	defaultGitHubAPIURL string = "https://api.github.com"
+
+	// rate limited requests are retried while the requested wait stays
+	// within gitHubMaxBackoff.
+	gitHubMaxRetries int           = 3
+	gitHubMaxBackoff time.Duration = time.Minute
+)
+
+type gitHubIssue struct {
+	Title  string   `json:"title"`
+	Body   string   `json:"body"`
+	Labels []string `json:"labels,omitempty"`
+}
+
+type gitHubSearchResult struct {
+	TotalCount int `json:"total_count"`
+}
+
+// gitHubSink opens an issue in repo for each new item at or above
+// minSeverity, labeled with its severity and matched filters. Items whose
+// CVE id already appears in an issue title are skipped.
+type gitHubSink struct {
+	client      *http.Client
+	apiURL      string
+	repo        string
+	token       string
+	minSeverity string
+	filters     []filter.Filter
+	deliveries  *deliveryTracker
+}
+
+func (s *gitHubSink) Write(item *rss.Item) error {
+	if severityRank(itemSeverity(item)) < severityRank(s.minSeverity) {
+		return nil
+	}
+
+	if err := s.openIssue(item); err != nil {
+		log.Printf("failed to open github issue for %s: %s", item.Title, err)
+		recordError("notify", err, item.ID)
+		s.deliveries.fail(item)
+	}
+
+	return nil
+}
+
+func (s *gitHubSink) openIssue(item *rss.Item) error {
+	key := cveID(item.Title)
+	if key == "" {
+		key = item.Title
+	}
+
+	exists, err := s.issueExists(key)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		verbosef("skipping github issue for %s: an issue already exists", key)
+		return nil
+	}
+
+	var labels []string
+	if severity := itemSeverity(item); severity != "" {
+		labels = append(labels, "severity:"+severity)
+	}
+	for _, label := range filter.MatchedLabels(item, s.filters) {
+		labels = append(labels, "filter:"+label)
+	}
+
+	data, err := json.Marshal(gitHubIssue{
+		Title:  item.Title,
+		Body:   fmt.Sprintf("%s\n\n%s", item.Link, item.Summary),
+		Labels: labels,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(http.MethodPost, fmt.Sprintf("%s/repos/%s/issues", s.apiURL, s.repo), data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func (s *gitHubSink) issueExists(key string) (bool, error) {
+	query := url.Values{
+		"q":        {fmt.Sprintf(`repo:%s is:issue in:title "%s"`, s.repo, key)},
+		"per_page": {"1"},
+	}
+
+	resp, err := s.do(http.MethodGet, s.apiURL+"/search/issues?"+query.Encode(), nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var result gitHubSearchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, err
+	}
+
+	return result.TotalCount > 0, nil
+}
+
+// do sends an authenticated request, waiting and retrying when GitHub
+// responds that the rate limit has been exceeded.
+func (s *gitHubSink) do(method, endpoint string, body []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+
+		req, err := http.NewRequest(method, endpoint, reader)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("Authorization", "Bearer "+s.token)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		wait, limited := gitHubRateLimitWait(resp)
+		if !limited || attempt >= gitHubMaxRetries || wait > gitHubMaxBackoff {
+			return nil, fmt.Errorf("%s %s returned status %s", method, endpoint, resp.Status)
+		}
+
+		log.Printf("github rate limit exceeded, retrying in %s", wait)
+		time.Sleep(wait)
+	}
+}
+
+// gitHubRateLimitWait reports whether resp is a rate limit response and how
+// long to wait before retrying, from either Retry-After or the rate limit
+// reset time.
+func gitHubRateLimitWait(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+		return wait, true
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+		if err != nil {
+			return 0, false
+		}
+
+		wait := time.Until(time.Unix(reset, 0))
+		if wait < 0 {
+			wait = 0
+		}
+
+		return wait, true
+	}
+
+	// a 403 without rate limit headers is a permission error
+	return 0, resp.StatusCode == http.StatusTooManyRequests
+}
+
+func (s *gitHubSink) Flush() error {
+	return nil
+}
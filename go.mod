@@ -1,6 +1,9 @@
 module github.com/ncatelli/sec-feed
 
-require github.com/SlyMarbo/rss v1.0.3
+require (
+	github.com/SlyMarbo/rss v1.0.3
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require github.com/axgle/mahonia v0.0.0-20180208002826-3358181d7394 // indirect
 
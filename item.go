@@ -0,0 +1,230 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/SlyMarbo/rss"
+	"github.com/ncatelli/sec-feed/filter"
+)
+
+var (
+	htmlTagPattern       = regexp.MustCompile(`<[^>]*>`)
+	cvePattern           = regexp.MustCompile(`(?i)\bCVE-\d{4}-\d{4,}\b`)
+	cvssScorePattern     = regexp.MustCompile(`(?i)\bcvss\b.{0,40}?\bscore\W{0,3}(\d{1,2}\.\d)\b`)
+	severityLabelPattern = regexp.MustCompile(`(?i)\bseverity\W{0,3}(critical|high|medium|low|none)\b`)
+	cvssVectorPattern    = regexp.MustCompile(`\b(?:CVSS:3\.[01]/)?AV:[NALP](?:/[A-Z]{1,2}:[A-Z])+`)
+)
+
+// splitTitle separates an NVD style title, "CVE-YYYY-NNNN (tag, tag)", into
+// the identifier and its parenthetical tags, split on -tag-separator.
+func splitTitle(title string) (string, []string) {
+	name := strings.TrimSpace(strings.SplitN(title, "(", 2)[0])
+	return name, filter.TitleTags(title, tagSeparator)
+}
+
+// rawTitleTags returns the unparsed parenthetical tag group of a title.
+func rawTitleTags(title string) string {
+	return filter.RawTitleTags(title)
+}
+
+// cveID returns the first CVE identifier in title, uppercased, or an empty
+// string if it has none.
+func cveID(title string) string {
+	return strings.ToUpper(cvePattern.FindString(title))
+}
+
+// cveLess orders CVE identifiers by year and then sequence number, sorting
+// empty identifiers last.
+func cveLess(a, b string) bool {
+	if a == "" || b == "" {
+		return a != "" && b == ""
+	}
+
+	aYear, aSeq := cveParts(a)
+	bYear, bSeq := cveParts(b)
+	if aYear != bYear {
+		return aYear < bYear
+	}
+
+	return aSeq < bSeq
+}
+
+// cveParts splits a CVE identifier into its year and sequence number.
+func cveParts(id string) (int, int) {
+	parts := strings.SplitN(id, "-", 3)
+	if len(parts) < 3 {
+		return 0, 0
+	}
+
+	year, _ := strconv.Atoi(parts[1])
+	seq, _ := strconv.Atoi(parts[2])
+	return year, seq
+}
+
+// summaryDescription returns summary as plain text with its html removed and
+// whitespace collapsed, truncated at a word boundary to at most max
+// characters. It is empty when max is 0.
+func summaryDescription(summary string, max int) string {
+	if max <= 0 {
+		return ""
+	}
+
+	text := html.UnescapeString(htmlTagPattern.ReplaceAllString(summary, " "))
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) <= max {
+		return string(runes)
+	}
+
+	const ellipsis = "..."
+	cut := max - len(ellipsis)
+	if cut < 0 {
+		cut = 0
+	}
+
+	truncated := string(runes[:cut])
+	if i := strings.LastIndex(truncated, " "); i > 0 {
+		truncated = truncated[:i]
+	}
+
+	return truncated + ellipsis
+}
+
+// cvssMetricValues names the values of the CVSS v3 base metrics, keyed by
+// the metric's abbreviation and then by the value's.
+var cvssMetricValues = map[string]map[string]string{
+	"AV": {"N": "network", "A": "adjacent", "L": "local", "P": "physical"},
+	"AC": {"L": "low", "H": "high"},
+	"PR": {"N": "none", "L": "low", "H": "high"},
+	"UI": {"N": "none", "R": "required"},
+	"S":  {"U": "unchanged", "C": "changed"},
+	"C":  {"N": "none", "L": "low", "H": "high"},
+	"I":  {"N": "none", "L": "low", "H": "high"},
+	"A":  {"N": "none", "L": "low", "H": "high"},
+}
+
+// cvssVector holds the named base metric values of a CVSS v3 vector string,
+// such as network for AV:N. Metrics missing from the vector are empty.
+type cvssVector struct {
+	Vector             string
+	AttackVector       string
+	AttackComplexity   string
+	PrivilegesRequired string
+	UserInteraction    string
+	Scope              string
+	Confidentiality    string
+	Integrity          string
+	Availability       string
+}
+
+// parseCVSSVector parses a vector string such as
+// CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H into its base metrics,
+// ignoring metrics and values it doesn't know.
+func parseCVSSVector(vector string) cvssVector {
+	v := cvssVector{Vector: vector}
+	for _, part := range strings.Split(vector, "/") {
+		metric, value, _ := strings.Cut(part, ":")
+		name := cvssMetricValues[metric][value]
+
+		switch metric {
+		case "AV":
+			v.AttackVector = name
+		case "AC":
+			v.AttackComplexity = name
+		case "PR":
+			v.PrivilegesRequired = name
+		case "UI":
+			v.UserInteraction = name
+		case "S":
+			v.Scope = name
+		case "C":
+			v.Confidentiality = name
+		case "I":
+			v.Integrity = name
+		case "A":
+			v.Availability = name
+		}
+	}
+
+	return v
+}
+
+// itemCVSSVector returns the first CVSS v3 vector string in an item's title,
+// summary or categories, or nil when it has none.
+func itemCVSSVector(item *rss.Item) *cvssVector {
+	for _, field := range append([]string{item.Title, item.Summary}, item.Categories...) {
+		if m := cvssVectorPattern.FindString(field); m != "" {
+			v := parseCVSSVector(m)
+			return &v
+		}
+	}
+
+	return nil
+}
+
+// validSeverityThreshold reports whether s is a severity rating, or any to
+// include items of unknown severity as well.
+func validSeverityThreshold(s string) bool {
+	return strings.EqualFold(s, "any") || severityRank(s) >= 0
+}
+
+// severityRank orders severity ratings from none to critical. Unknown
+// ratings, and the any threshold, rank below none.
+func severityRank(severity string) int {
+	switch strings.ToLower(severity) {
+	case "none":
+		return 0
+	case "low":
+		return 1
+	case "medium":
+		return 2
+	case "high":
+		return 3
+	case "critical":
+		return 4
+	default:
+		return -1
+	}
+}
+
+// severityFromScore maps a CVSS v3 base score to its qualitative rating.
+func severityFromScore(score float64) string {
+	switch {
+	case score >= 9.0:
+		return "critical"
+	case score >= 7.0:
+		return "high"
+	case score >= 4.0:
+		return "medium"
+	case score > 0:
+		return "low"
+	default:
+		return "none"
+	}
+}
+
+// itemSeverity returns the lowercase severity rating of an item, derived from
+// a CVSS base score or an explicit severity label in its categories, title or
+// summary. Items carrying neither return an empty string.
+func itemSeverity(item *rss.Item) string {
+	fields := append([]string{item.Title, item.Summary}, item.Categories...)
+
+	for _, field := range fields {
+		if m := cvssScorePattern.FindStringSubmatch(field); m != nil {
+			score, err := strconv.ParseFloat(m[1], 64)
+			if err == nil && score <= 10 {
+				return severityFromScore(score)
+			}
+		}
+	}
+
+	for _, field := range fields {
+		if m := severityLabelPattern.FindStringSubmatch(field); m != nil {
+			return strings.ToLower(m[1])
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/SlyMarbo/rss"
+)
+
+type jiraIssue struct {
+	Fields jiraFields `json:"fields"`
+}
+
+type jiraFields struct {
+	Project     jiraKey  `json:"project"`
+	Summary     string   `json:"summary"`
+	Description string   `json:"description"`
+	IssueType   jiraName `json:"issuetype"`
+}
+
+type jiraKey struct {
+	Key string `json:"key"`
+}
+
+type jiraName struct {
+	Name string `json:"name"`
+}
+
+type jiraSearchResult struct {
+	Total int `json:"total"`
+}
+
+// jiraSink creates a JIRA issue for each new item at or above minSeverity,
+// skipping items whose CVE id already appears in the summary of an issue in
+// the project.
+type jiraSink struct {
+	client      *http.Client
+	url         string
+	project     string
+	issueType   string
+	user        string
+	token       string
+	minSeverity string
+	deliveries  *deliveryTracker
+}
+
+func (s *jiraSink) Write(item *rss.Item) error {
+	if severityRank(itemSeverity(item)) < severityRank(s.minSeverity) {
+		return nil
+	}
+
+	if err := s.createIssue(item); err != nil {
+		log.Printf("failed to create jira issue for %s: %s", item.Title, err)
+		recordError("notify", err, item.ID)
+		s.deliveries.fail(item)
+	}
+
+	return nil
+}
+
+func (s *jiraSink) createIssue(item *rss.Item) error {
+	key := cveID(item.Title)
+	if key == "" {
+		key = item.Title
+	}
+
+	exists, err := s.issueExists(key)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		verbosef("skipping jira issue for %s: an issue already exists", key)
+		return nil
+	}
+
+	issue := jiraIssue{
+		Fields: jiraFields{
+			Project:     jiraKey{Key: s.project},
+			Summary:     truncateText(item.Title, 255),
+			Description: fmt.Sprintf("%s\n\n%s", item.Link, item.Summary),
+			IssueType:   jiraName{Name: s.issueType},
+		},
+	}
+
+	data, err := json.Marshal(issue)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(http.MethodPost, s.url+"/rest/api/2/issue", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func (s *jiraSink) issueExists(key string) (bool, error) {
+	jql := fmt.Sprintf(`project = "%s" AND summary ~ "\"%s\""`, jqlEscape(s.project), jqlEscape(key))
+	query := url.Values{
+		"jql":        {jql},
+		"maxResults": {"1"},
+		"fields":     {"summary"},
+	}
+
+	resp, err := s.do(http.MethodGet, s.url+"/rest/api/2/search?"+query.Encode(), nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var result jiraSearchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, err
+	}
+
+	return result.Total > 0, nil
+}
+
+// do sends an authenticated request, using basic auth when a user is set and
+// a bearer token otherwise.
+func (s *jiraSink) do(method, endpoint string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	if s.user != "" {
+		req.SetBasicAuth(s.user, s.token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s returned status %s", method, s.url, resp.Status)
+	}
+
+	return resp, nil
+}
+
+func (s *jiraSink) Flush() error {
+	return nil
+}
+
+func jqlEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockPollInterval is how often a held lock is retried while waiting for it.
+const lockPollInterval time.Duration = 100 * time.Millisecond
+
+// cacheLock is the cache lock held for the whole run. It is kept in a
+// package variable because a lock file no longer referenced is closed by its
+// finalizer on the next garbage collection, releasing the lock while the run
+// is still going.
+var cacheLock *os.File
+
+// lockCache takes the cache lock at path for the rest of the run, waiting up
+// to timeout for another run to release it.
+func lockCache(path string, timeout time.Duration) error {
+	f, err := lockFileTimeout(path, timeout)
+	if err != nil {
+		return err
+	}
+
+	cacheLock = f
+	return nil
+}
+
+// lockFile takes an exclusive advisory lock on the file at path, creating it
+// if needed and waiting for any other holder to release it. The lock is held
+// until the returned file is closed or the process exits.
+func lockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := flock(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// lockFileTimeout is lockFile giving up once the lock has been held by
+// another process for longer than timeout.
+func lockFileTimeout(path string, timeout time.Duration) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryFlock(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		} else if locked {
+			return f, nil
+		}
+
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("%s is locked by another run", path)
+		}
+
+		time.Sleep(lockPollInterval)
+	}
+}
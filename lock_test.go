@@ -0,0 +1,120 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockCacheHeldAcrossGC(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.lock")
+	if err := lockCache(path, 0); err != nil {
+		t.Fatalf("lockCache(%q) error = %s", path, err)
+	}
+	defer cacheLock.Close()
+
+	// an unreferenced lock file would be closed by its finalizer here
+	for i := 0; i < 3; i++ {
+		runtime.GC()
+	}
+
+	if f, err := lockFileTimeout(path, 0); err == nil {
+		f.Close()
+		t.Fatal("the cache lock was released while still held")
+	}
+}
+
+func TestOpenOutputFileAppendLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+	w, lock, err := openOutputFile(path, true, 0)
+	if err != nil {
+		t.Fatalf("openOutputFile(%q) error = %s", path, err)
+	}
+	if lock == nil {
+		t.Fatal("openOutputFile returned no lock when appending")
+	}
+	outputLock = lock
+	defer outputLock.Close()
+	defer w.(interface{ Close() error }).Close()
+
+	for i := 0; i < 3; i++ {
+		runtime.GC()
+	}
+
+	if f, err := lockFileTimeout(path+".lock", 0); err == nil {
+		f.Close()
+		t.Fatal("the output lock was released while still held")
+	}
+
+	w, lock, err = openOutputFile(path, false, 0)
+	if err != nil || lock != nil {
+		t.Fatalf("openOutputFile(%q, false) = lock %v, error %v, want neither", path, lock, err)
+	}
+	w.(interface{ Close() error }).Close()
+}
+
+// TestLockCacheAcrossProcesses runs a second process holding the cache lock
+// until its stdin is closed, as an overlapping run would.
+func TestLockCacheAcrossProcesses(t *testing.T) {
+	if path := os.Getenv("SEC_FEED_TEST_LOCK_PATH"); path != "" {
+		if err := lockCache(path, 0); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Println("locked")
+		io.Copy(io.Discard, os.Stdin)
+		os.Exit(0)
+	}
+
+	path := filepath.Join(t.TempDir(), "cache.lock")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLockCacheAcrossProcesses$")
+	cmd.Env = append(os.Environ(), "SEC_FEED_TEST_LOCK_PATH="+path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+	defer stdin.Close()
+
+	if line, _ := bufio.NewReader(stdout).ReadString('\n'); line != "locked\n" {
+		t.Fatalf("the other run failed to take the lock: %q", line)
+	}
+
+	// a second run gives up once the timeout passes
+	if f, err := lockFileTimeout(path, 200*time.Millisecond); err == nil {
+		f.Close()
+		t.Fatal("took the cache lock held by another run")
+	} else if !strings.Contains(err.Error(), "locked by another run") {
+		t.Fatalf("lockFileTimeout() error = %s, want the lock to be held", err)
+	}
+
+	// or waits for the other run to finish
+	time.AfterFunc(200*time.Millisecond, func() { stdin.Close() })
+	start := time.Now()
+	f, err := lockFileTimeout(path, 10*time.Second)
+	if err != nil {
+		t.Fatalf("lockFileTimeout() error = %s after the other run finished", err)
+	}
+	f.Close()
+
+	if waited := time.Since(start); waited < 100*time.Millisecond {
+		t.Errorf("took the lock after %s, before the other run released it", waited)
+	}
+}
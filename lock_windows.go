@@ -0,0 +1,14 @@
+package main
+
+import (
+	"os"
+)
+
+// flock is a no-op on windows, where concurrent runs are not guarded against.
+func flock(f *os.File) error {
+	return nil
+}
+
+func tryFlock(f *os.File) (bool, error) {
+	return true, nil
+}
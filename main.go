@@ -1,25 +1,39 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
+	"unicode/utf8"
 
 	"github.com/SlyMarbo/rss"
+	"github.com/ncatelli/sec-feed/filter"
 )
 
 const (
 	cacheFile            string = "cache.json"
+	cacheLockFile        string = ".lock"
+	defaultTagSeparator  string = filter.DefaultTagSeparator
 	defaultRssFeedSource string = "https://nvd.nist.gov/feeds/xml/cve/misc/nvd-rss-analyzed.xml"
 
+	// truncatedSummaryNotice follows summaries cut short in generated pages.
+	truncatedSummaryNotice string = "\n\n_This summary was truncated._"
+
 	defaultOutputFormatting string = `----
 {{ .Title }}
 {{ .Date }}
@@ -31,24 +45,111 @@ const (
 	defaultGeneratedSiteFormatting string = `---
 title: {{ .Meta.Title  }}
 date: {{ .Meta.Date  }}
-cve: {{ .Meta.Link  }}
+cve: {{ or .Meta.Link .Meta.CVE }}
 tags: {{ range .Meta.Tags }}
   - {{. | js}}{{end}}
-draft: false
+{{ with .Meta.Description }}description: {{ printf "%q" . }}
+{{ end }}draft: false
 ---
 
-<a href="{{ .Meta.Link }}">{{ .Meta.Link }}</a>
+{{ with .Meta.Link }}<a href="{{ . }}">{{ . }}</a>{{ end }}
 	
 {{ .Summary }}
 `
 )
 
 var (
-	feedUrl      string
-	confPath     string
-	cachePath    string
-	sitePath     string
-	formatOutput string
+	feedUrl              string
+	cachePath            string
+	sitePath             string
+	formatOutput         string
+	outputPreset         string
+	renotify             bool
+	onCollision          string
+	commitOnSuccess      bool
+	exportPath           string
+	insecure             bool
+	maxRedirects         int
+	verbose              bool
+	allowEmpty           bool
+	minItems             int
+	generateFormat       string
+	normalizeWhitespace  bool
+	allowDomains         *stringList
+	denyDomains          *stringList
+	dryRun               bool
+	pagerDutyRoutingKey  string
+	pagerDutyMinSeverity string
+	teamsWebhook         string
+	matrixHomeserver     string
+	matrixToken          string
+	matrixRoom           string
+	notifyRate           int
+	notifyMaxPerRun      int
+	notifyLogPath        string
+	notifyLogRetention   time.Duration
+	notifyTemplate       string
+	notifyTemplateFile   string
+	jiraURL              string
+	jiraProject          string
+	jiraIssueType        string
+	jiraUser             string
+	jiraToken            string
+	jiraMinSeverity      string
+	gitHubRepo           string
+	gitHubToken          string
+	gitHubAPIURL         string
+	gitHubMinSeverity    string
+	openLinks            bool
+	openLimit            int
+	afterGUID            string
+	errorFile            string
+	feedTitle            string
+	maxAge               time.Duration
+	keepUndated          bool
+	allowMissingFilters  bool
+	topItems             int
+	filterWeight         int
+	severityWeight       int
+	outputFile           string
+	fifoTimeout          time.Duration
+	resetMatching        bool
+	resetSince           string
+	noCache              bool
+	cacheFileMode        os.FileMode
+	generateFileMode     os.FileMode
+	dirMode              os.FileMode
+	tagAliasesPath       string
+	tagSeparator         string
+	appendOutput         bool
+	lockTimeout          time.Duration
+	outputFields         []string
+	allMarksRead         bool
+	descriptionLength    int
+	fetchRetries         int
+	maxRetryWait         time.Duration
+	onlyFilter           string
+	matchReportFile      string
+	splitOutput          bool
+	outputPathTemplate   string
+	maxSummaryBytes      int
+	linkPattern          *regexp.Regexp
+	sinceLastRun         bool
+	failFast             bool
+	bom                  bool
+	lineEnding           string
+	autodiscover         bool
+	filterLabelsPath     string
+	quiet                bool
+	templateDir          string
+	templateName         string
+	cacheFileName        string
+	autoReadAge          time.Duration
+	attackVectors        map[string]bool
+	privilegesRequired   map[string]bool
+	explain              bool
+	cacheEncoding        cacheCodec
+	colorMode            string
 )
 
 func getEnvOr(key, defaultVal string) string {
@@ -60,86 +161,419 @@ func getEnvOr(key, defaultVal string) string {
 	}
 }
 
-func loadCachedFeed(feedPath string) (*rss.Feed, error) {
-	cachedFeed := &rss.Feed{}
+// cachedFeed is the on-disk representation of the feed cache. The feed is
+// embedded so that caches written by earlier versions still load.
+type cachedFeed struct {
+	*rss.Feed
+
+	// Hashes maps each item ID to the content hash of its title and summary.
+	Hashes map[string]string `json:"hashes,omitempty"`
+
+	// FirstSeen maps each item ID to when it was first fetched. Items cached
+	// by earlier versions have no entry.
+	FirstSeen map[string]time.Time `json:"first_seen,omitempty"`
+
+	// LastRun is when all last ran with -since-last-run.
+	LastRun time.Time `json:"last_run"`
+}
+
+// markSeen records now as the first time item was fetched, unless it was
+// seen before.
+func (f *cachedFeed) markSeen(item *rss.Item, now time.Time) {
+	if f.FirstSeen == nil {
+		f.FirstSeen = make(map[string]time.Time)
+	}
+
+	if _, ok := f.FirstSeen[item.ID]; !ok {
+		f.FirstSeen[item.ID] = now
+	}
+}
+
+// markAgedRead marks the unread items published before cutoff as read,
+// leaving items without a date unread.
+func (f *cachedFeed) markAgedRead(cutoff time.Time) {
+	for _, item := range f.Items {
+		if item.Read || item.Date.IsZero() || !item.Date.Before(cutoff) {
+			continue
+		}
+
+		item.Read = true
+		if f.Unread > 0 {
+			f.Unread--
+		}
+	}
+}
+
+var errUpdateNotReady = errors.New("not ready to update: too soon to refresh")
+
+func contentHash(item *rss.Item) string {
+	sum := sha256.Sum256([]byte(item.Title + "\x00" + item.Summary))
+	return hex.EncodeToString(sum[:])
+}
+
+func getEnvIntOr(key string, defaultVal int) int {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultVal
+	}
+
+	i, err := strconv.Atoi(val)
+	if err != nil {
+		return defaultVal
+	}
+
+	return i
+}
+
+// verbosef logs only when -verbose is set.
+func verbosef(format string, v ...interface{}) {
+	if verbose {
+		log.Printf(format, v...)
+	}
+}
+
+// verboseSince logs at verbose level the phase described by format along
+// with how long it took since start.
+func verboseSince(start time.Time, format string, v ...interface{}) {
+	verbosef(format+" in %s", append(v, time.Since(start))...)
+}
+
+func getEnvDurationOr(key string, defaultVal time.Duration) time.Duration {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultVal
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return defaultVal
+	}
+
+	return d
+}
+
+// getEnvFileModeOr reads an octal file mode such as 0640 from key, warning
+// and falling back to defaultVal when it is invalid.
+func getEnvFileModeOr(key string, defaultVal os.FileMode) os.FileMode {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultVal
+	}
+
+	mode, err := parseFileMode(val)
+	if err != nil {
+		log.Printf("WARNING: ignoring %s: %s", key, err)
+		return defaultVal
+	}
+
+	return mode
+}
+
+// parseFileMode parses an octal permission mode, rejecting anything beyond
+// the permission bits.
+func parseFileMode(val string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(val, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid file mode %s, expected octal permissions such as 0644", val)
+	}
+
+	return os.FileMode(mode), nil
+}
+
+// fileModeValue is a flag holding an octal file mode.
+type fileModeValue struct {
+	mode *os.FileMode
+}
+
+func (v fileModeValue) String() string {
+	if v.mode == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%04o", uint32(*v.mode))
+}
+
+func (v fileModeValue) Set(val string) error {
+	mode, err := parseFileMode(val)
+	if err != nil {
+		return err
+	}
+
+	*v.mode = mode
+	return nil
+}
+
+func getEnvBoolOr(key string, defaultVal bool) bool {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultVal
+	}
+
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return defaultVal
+	}
+
+	return b
+}
+
+func loadCachedFeed(feedPath string) (*cachedFeed, error) {
+	cache := &cachedFeed{}
 
+	start := time.Now()
 	cachedFileData, err := os.ReadFile(feedPath)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := json.Unmarshal(cachedFileData, cachedFeed); err != nil {
+	if err := detectCacheCodec(cachedFileData).decode(cachedFileData, cache); err != nil {
 		return nil, err
 	}
 
-	return cachedFeed, nil
+	if cache.Feed == nil {
+		return nil, errors.New("the cache holds no feed")
+	}
+
+	verboseSince(start, "loaded %d cached items from %s", len(cache.Items), feedPath)
+	return cache, nil
+}
+
+// writeFileAtomic writes data to a temporary file alongside path before
+// renaming it into place, so readers never observe a partial file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
 }
 
-func cacheFeed(cachePath string, feed *rss.Feed) error {
-	// mark all items as read prior to caching
+// cacheFeed marks every item read and caches the feed.
+func cacheFeed(cachePath string, feed *cachedFeed) error {
+	// -no-cache leaves the cache and the read state it holds untouched
+	if noCache {
+		return nil
+	}
+
 	for _, item := range feed.Items {
 		item.Read = true
 	}
 	feed.Unread = 0
 
-	data, err := json.Marshal(feed)
+	return storeFeed(cachePath, feed)
+}
+
+// storeFeed caches the content of the feed without consuming its unread
+// items, other than those older than -auto-read-age, recording the content
+// hash of every item.
+func storeFeed(cachePath string, feed *cachedFeed) error {
+	if noCache {
+		return nil
+	}
+
+	if autoReadAge > 0 {
+		feed.markAgedRead(time.Now().Add(-autoReadAge))
+	}
+
+	feed.Hashes = make(map[string]string, len(feed.Items))
+	for _, item := range feed.Items {
+		feed.Hashes[item.ID] = contentHash(item)
+	}
+
+	return writeCache(cachePath, feed)
+}
+
+// writeCache writes feed to the cache in -cache-format as is, leaving the
+// read state of its items untouched.
+func writeCache(cachePath string, feed *cachedFeed) error {
+	start := time.Now()
+	data, err := cacheEncoding.encode(feed)
 	if err != nil {
 		return err
 	}
 
-	if err := os.WriteFile(cachePath, data, 0644); err != nil {
+	if err := writeFileAtomic(cachePath, data, cacheFileMode); err != nil {
 		return err
 	}
 
+	verboseSince(start, "cached %d items to %s", len(feed.Items), cachePath)
 	return nil
 }
 
-func fetch_feed(feedUrl, absoluteCacheFilePath string, ignoreUpdate bool) (*rss.Feed, bool, error) {
-	req, err := url.Parse(feedUrl)
+// updateFeed mirrors rss.Feed.Update, appending any unseen items as unread.
+// When renotify is set, previously seen items whose content hash differs
+// from the cached hash are replaced by their upstream revision and marked
+// unread again.
+func updateFeed(client *http.Client, feed *cachedFeed, renotify bool) error {
+	if feed.Refresh.After(time.Now()) {
+		return errUpdateNotReady
+	}
+
+	if feed.UpdateURL == "" {
+		return errors.New("feed has no URL")
+	}
+
+	if feed.ItemMap == nil {
+		feed.ItemMap = make(map[string]struct{})
+		for _, item := range feed.Items {
+			feed.ItemMap[item.ID] = struct{}{}
+		}
+	}
+
+	update, err := fetchUpstream(client, feed.UpdateURL)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	feed, err := loadCachedFeed(absoluteCacheFilePath)
-	cached := false
+	if len(update.Items) == 0 && len(feed.Items) > 0 && !allowEmpty {
+		return fmt.Errorf("refusing to update the cache from %s: the feed is empty", feed.UpdateURL)
+	}
 
-	// update the feed from cache
-	if !errors.Is(err, os.ErrNotExist) {
-		err := feed.Update()
-		if err != nil && feed != nil && ignoreUpdate {
-			return feed, true, nil
-		} else if err != nil {
-			return nil, cached, err
+	if len(update.Items) < minItems && len(feed.Items) > len(update.Items) {
+		log.Printf("WARNING: %s returned %d items, fewer than the minimum of %d, keeping the %d cached items without updating", feed.UpdateURL, len(update.Items), minItems, len(feed.Items))
+		return nil
+	}
+
+	feed.Refresh = update.Refresh
+	feed.Title = update.Title
+	feed.Description = update.Description
+
+	cachedItems := make(map[string]int, len(feed.Items))
+	for i, item := range feed.Items {
+		cachedItems[item.ID] = i
+	}
+
+	now := time.Now()
+	for _, item := range update.Items {
+		if _, ok := feed.ItemMap[item.ID]; !ok {
+			feed.Items = append(feed.Items, item)
+			feed.ItemMap[item.ID] = struct{}{}
+			feed.markSeen(item, now)
+			feed.Unread++
+			continue
+		}
+
+		i, ok := cachedItems[item.ID]
+		if !renotify || !ok {
+			continue
 		}
 
-		cached = true
+		prev, ok := feed.Hashes[item.ID]
+		if ok && prev != contentHash(item) {
+			feed.Items[i] = item
+			feed.Unread++
+		}
+	}
+
+	return nil
+}
+
+// cacheFilePath returns the path of the cache file named by -cache-file,
+// which is relative to the cache directory unless it is absolute.
+func cacheFilePath(dir, name string) string {
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name)
+	}
+
+	return filepath.Join(dir, name)
+}
+
+// cacheLockPath returns the lock file guarding the cache file at path. Runs
+// using the default cache file of dir share its lock, while any other cache
+// file is locked on its own so configs sharing a directory don't wait on
+// each other.
+func cacheLockPath(dir, path string) string {
+	if path == filepath.Join(dir, cacheFile) {
+		return filepath.Join(dir, cacheLockFile)
+	}
+
+	return path + cacheLockFile
+}
+
+// fetch_feed returns the cached feed updated from upstream, or the upstream
+// feed when there is no cache, along with whether it came from the cache.
+// With ignoreUpdate a failed update returns the cached feed unchanged. The
+// returned feed is never nil when err is nil.
+func fetch_feed(client *http.Client, feedUrl, absoluteCacheFilePath string, ignoreUpdate, renotify bool) (*cachedFeed, bool, error) {
+	req, err := url.Parse(feedUrl)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var feed *cachedFeed
+	if noCache {
+		err = os.ErrNotExist
 	} else {
-		upstream, err := rss.Fetch(req.String())
+		feed, err = loadCachedFeed(absoluteCacheFilePath)
+	}
+
+	if errors.Is(err, os.ErrNotExist) {
+		upstream, err := fetchUpstream(client, req.String())
 		if err != nil {
-			return nil, cached, err
+			return nil, false, err
+		}
+
+		feed := &cachedFeed{Feed: upstream}
+		now := time.Now()
+		for _, item := range upstream.Items {
+			feed.markSeen(item, now)
+		}
+
+		return feed, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("failed to load cache %s: %s", absoluteCacheFilePath, err)
+	}
+
+	// update the feed from cache
+	if err := updateFeed(client, feed, renotify); err != nil {
+		if !ignoreUpdate {
+			return nil, false, err
 		}
 
-		feed = upstream
-		cached = false
+		verbosef("using the cached feed, update failed: %s", err)
 	}
 
-	return feed, cached, nil
+	return feed, true, nil
 }
 
 func printHelp() {
 	fmt.Println("Usage: sec-feed [OPTIONS]...")
 	fmt.Printf("A cli checker utility for generating vulnerabilty feeds.\n")
 	fmt.Printf("commands:\n")
-	fmt.Printf("  new\n  all\n  generate\n")
+	fmt.Printf("  new\n  all\n  generate\n  export\n  stats\n  reset-read\n")
 	fmt.Printf("flags:\n")
 
 	flag.PrintDefaults()
 }
 
-func cmdNewItems(feed *rss.Feed, cacheFilePath string, filters map[string]string, cached bool) error {
-	var newItems []*rss.Item
+func cmdNewItems(feed *cachedFeed, cacheFilePath string, filters []filter.Filter, cached bool, sinks []sink) error {
+	selector := newItemSelector(filters)
 
-	if cached {
+	// items older than -auto-read-age are handled without being output
+	if autoReadAge > 0 {
+		feed.markAgedRead(time.Now().Add(-autoReadAge))
+	}
+
+	// snapshot the unread items, caching marks every item read. Without a
+	// cache every item of the fetched feed is new.
+	var newItems []*rss.Item
+	if cached || noCache {
 		for _, item := range feed.Items {
 			if !item.Read {
 				newItems = append(newItems, item)
@@ -147,194 +581,920 @@ func cmdNewItems(feed *rss.Feed, cacheFilePath string, filters map[string]string
 		}
 	}
 
-	if err := cacheFeed(cacheFilePath, feed); err != nil {
-		return fmt.Errorf("failed to cache %s: %s", cacheFilePath, err)
+	// without commit-on-success, items are marked read before any output is
+	// attempted and a failed render drops them from future runs.
+	if !commitOnSuccess {
+		if err := cacheFeed(cacheFilePath, feed); err != nil {
+			return fmt.Errorf("failed to cache %s: %s", cacheFilePath, err)
+		}
 	}
 
-	// setup template
-	outputTemplate, err := template.New("output").Parse(formatOutput)
-	if err != nil {
+	start := time.Now()
+	matched := 0
+	for _, item := range newItems {
+		if !selector.Matches(item) {
+			continue
+		}
+
+		matched++
+		if err := writeToSinks(sinks, item); err != nil {
+			return err
+		}
+	}
+	verboseSince(start, "matched and wrote %d of %d new items", matched, len(newItems))
+
+	if err := flushSinks(sinks); err != nil {
 		return err
 	}
 
-	var newItemsMatchingFilters []*rss.Item
-	for _, item := range newItems {
-		for _, filter := range filters {
-			if strings.Contains(item.Title, filter) {
-				newItemsMatchingFilters = append(newItemsMatchingFilters, item)
-				break
-			}
+	if commitOnSuccess {
+		if err := cacheFeed(cacheFilePath, feed); err != nil {
+			return fmt.Errorf("failed to cache %s: %s", cacheFilePath, err)
 		}
 	}
 
-	for _, item := range newItemsMatchingFilters {
-		err = outputTemplate.Execute(os.Stdout, item)
-		if err != nil {
+	return nil
+}
+
+// itemsAfter returns the items published after the item with the given guid,
+// with items sharing its date ordered by their position in the feed.
+func itemsAfter(items []*rss.Item, guid string) ([]*rss.Item, error) {
+	cursor := -1
+	for i, item := range items {
+		if item.ID == guid {
+			cursor = i
+			break
+		}
+	}
+
+	if cursor < 0 {
+		return nil, fmt.Errorf("item %s not found in the feed", guid)
+	}
+
+	var after []*rss.Item
+	for i, item := range items {
+		if item.Date.After(items[cursor].Date) || (item.Date.Equal(items[cursor].Date) && i > cursor) {
+			after = append(after, item)
+		}
+	}
+
+	return after, nil
+}
+
+func cmdAll(feed *cachedFeed, cacheFilePath string, filters []filter.Filter, afterGUID string, sinceLastRun bool, sinks []sink) error {
+	selector := newItemSelector(filters)
+	runAt := time.Now()
+
+	items := feed.Items
+	if afterGUID != "" {
+		var err error
+		if items, err = itemsAfter(items, afterGUID); err != nil {
+			return err
+		}
+	}
+
+	if sinceLastRun {
+		items = itemsSeenAfter(feed, items, feed.LastRun)
+	}
+
+	// all leaves the new items for the next new run unless -all-marks-read
+	store := storeFeed
+	if allMarksRead {
+		store = cacheFeed
+	}
+
+	if err := store(cacheFilePath, feed); err != nil {
+		return fmt.Errorf("failed to cache %s: %s", cacheFilePath, err)
+	}
+
+	start := time.Now()
+	matched := 0
+	for _, item := range items {
+		if !selector.Matches(item) {
+			continue
+		}
+
+		matched++
+		if err := writeToSinks(sinks, item); err != nil {
 			return err
 		}
 	}
+	verboseSince(start, "matched and wrote %d of %d items", matched, len(items))
+
+	if err := flushSinks(sinks); err != nil {
+		return err
+	}
+
+	// only move the last run forward once its items have been output
+	if sinceLastRun {
+		feed.LastRun = runAt
+		if err := writeCache(cacheFilePath, feed); err != nil {
+			return fmt.Errorf("failed to cache %s: %s", cacheFilePath, err)
+		}
+	}
 
 	return nil
 }
 
-func cmdAll(feed *rss.Feed, cacheFilePath string, filters map[string]string) error {
-	if err := cacheFeed(cacheFilePath, feed); err != nil {
+// itemsSeenAfter returns the items first fetched after t.
+func itemsSeenAfter(feed *cachedFeed, items []*rss.Item, t time.Time) []*rss.Item {
+	var seen []*rss.Item
+	for _, item := range items {
+		if firstSeen, ok := feed.FirstSeen[item.ID]; ok && firstSeen.After(t) {
+			seen = append(seen, item)
+		}
+	}
+
+	return seen
+}
+
+// loadExport reads the records of an earlier export, returning none when it
+// doesn't exist yet.
+func loadExport(exportFilePath string) ([]itemRecord, error) {
+	data, err := os.ReadFile(exportFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// exports written with -bom start with one
+	data = bytes.TrimPrefix(data, []byte(utf8BOM))
+
+	var records []itemRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse export %s: %s", exportFilePath, err)
+	}
+
+	return records, nil
+}
+
+// cmdExport writes the matching items to exportFilePath as a JSON array.
+// When appending, the items of an earlier export are kept and the array is
+// extended with the items it doesn't hold yet.
+func cmdExport(feed *cachedFeed, cacheFilePath string, exportFilePath string, filters []filter.Filter, appending bool) error {
+	selector := newItemSelector(filters)
+
+	// like all, export leaves the new items for the next new run
+	if err := storeFeed(cacheFilePath, feed); err != nil {
 		return fmt.Errorf("failed to cache %s: %s", cacheFilePath, err)
 	}
 
-	// setup template
-	outputTemplate, err := template.New("output").Parse(formatOutput)
+	seen := make(map[string]struct{})
+	records := []itemRecord{}
+	if appending {
+		lock, err := lockFile(exportFilePath + ".lock")
+		if err != nil {
+			return err
+		}
+		defer lock.Close()
+
+		existing, err := loadExport(exportFilePath)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range existing {
+			seen[record.ID] = struct{}{}
+			records = append(records, record)
+		}
+	}
+
+	start := time.Now()
+	matched := 0
+	for _, item := range feed.Items {
+		if _, ok := seen[item.ID]; ok || !selector.Matches(item) {
+			continue
+		}
+
+		matched++
+		seen[item.ID] = struct{}{}
+		records = append(records, newItemRecord(item))
+	}
+	verboseSince(start, "matched %d of %d items", matched, len(feed.Items))
+
+	// newest first, falling back to the CVE number and id for a stable order
+	sort.SliceStable(records, func(i, j int) bool {
+		if !records[i].Date.Equal(records[j].Date) {
+			return records[i].Date.After(records[j].Date)
+		}
+
+		if records[i].CVE != records[j].CVE {
+			return cveLess(records[i].CVE, records[j].CVE)
+		}
+
+		return records[i].ID < records[j].ID
+	})
+
+	data, err := json.MarshalIndent(records, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	var itemsMatchingFilters []*rss.Item
+	return writeFileAtomic(exportFilePath, encodeFileOutput(data), 0644)
+}
+
+// cmdResetRead marks the cached items unread so they are output by the next
+// run of new, optionally only those matching the filters or published after
+// since, and makes the feed due for a refresh.
+func cmdResetRead(cacheFilePath string, filters []filter.Filter, matching bool, since time.Time) error {
+	feed, err := loadCachedFeed(cacheFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to load cache %s: %s", cacheFilePath, err)
+	}
+
+	selector := newItemSelector(filters)
+
+	reset := 0
+	feed.Unread = 0
 	for _, item := range feed.Items {
-		for _, filter := range filters {
-			if strings.Contains(item.Title, filter) {
-				itemsMatchingFilters = append(itemsMatchingFilters, item)
-				break
-			}
+		if item.Read && (!matching || selector.Matches(item)) && (since.IsZero() || item.Date.After(since)) {
+			item.Read = false
+			reset++
 		}
-	}
 
-	for _, item := range itemsMatchingFilters {
-		err = outputTemplate.Execute(os.Stdout, item)
-		if err != nil {
-			return err
+		if !item.Read {
+			feed.Unread++
 		}
 	}
 
+	// new only outputs unread items once the feed is due for a refresh
+	feed.Refresh = time.Time{}
+
+	if err := writeCache(cacheFilePath, feed); err != nil {
+		return fmt.Errorf("failed to cache %s: %s", cacheFilePath, err)
+	}
+
+	fmt.Printf("marked %d items unread\n", reset)
 	return nil
 }
 
+// parseDate parses a date given on the command line, either as a day or a
+// full RFC3339 timestamp.
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
 // Item represents a single story.
 type PageMeta struct {
-	Title string    `json:"title" yaml:"title"`
-	Link  string    `json:"link" yaml:"link"`
-	Date  time.Time `json:"date" yaml:"date"`
-	Tags  []string  `json:"tags" yaml:"tags"`
+	Title          string    `json:"title" yaml:"title"`
+	CVE            string    `json:"cve" yaml:"cve"`
+	RawTitle       string    `json:"raw_title" yaml:"raw_title"`
+	RawTags        string    `json:"raw_tags" yaml:"raw_tags"`
+	Link           string    `json:"link" yaml:"link"`
+	Date           time.Time `json:"date" yaml:"date"`
+	Tags           []string  `json:"tags" yaml:"tags"`
+	MatchedFilters []string  `json:"matched_filters" yaml:"matched_filters"`
+	Description    string    `json:"description" yaml:"description"`
 }
 
 type PageData struct {
-	Meta    PageMeta `json:"title" yaml:"meta"`
-	Summary string   `json:"summary" yaml:"summary"`
+	Meta      PageMeta `json:"title" yaml:"meta"`
+	Summary   string   `json:"summary" yaml:"summary"`
+	FeedTitle string   `json:"feed_title" yaml:"feed_title"`
 }
 
-func cmdGenerate(feed *rss.Feed, cacheFilePath string, siteFilePath string, filters map[string]string) error {
-	if err := cacheFeed(cacheFilePath, feed); err != nil {
-		return fmt.Errorf("failed to cache %s: %s", cacheFilePath, err)
+// itemName returns the CVE id of a page, falling back to the title of items
+// without one. Pages are named after it.
+func itemName(meta PageMeta) string {
+	if meta.CVE != "" {
+		return meta.CVE
+	}
+
+	return meta.Title
+}
+
+// truncateBytes shortens s to at most n bytes without splitting a character.
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
+
+// displayFeedTitle returns the -feed-title override, falling back to the
+// title of the source feed.
+func displayFeedTitle(feed *cachedFeed) string {
+	if feedTitle != "" {
+		return feedTitle
+	}
+
+	return feed.Title
+}
+
+func cmdGenerate(feed *cachedFeed, cacheFilePath string, siteFilePath string, filters []filter.Filter, tagAliases map[string]string, dryRun bool) error {
+	selector := newItemSelector(filters)
+
+	if !dryRun {
+		if err := cacheFeed(cacheFilePath, feed); err != nil {
+			return fmt.Errorf("failed to cache %s: %s", cacheFilePath, err)
+		}
 	}
 
 	// setup template
-	outputTemplate, err := template.New("hugo").Parse(defaultGeneratedSiteFormatting)
+	outputTemplate, err := parseGenerateTemplate()
 	if err != nil {
 		return err
 	}
 
-	var itemsMatchingFilters []*rss.Item
+	contentDir := filepath.Join(siteFilePath, "content", "cve")
+	if !dryRun {
+		if err := os.MkdirAll(contentDir, dirMode); err != nil {
+			return err
+		}
+	}
+
+	// track the number of items written to each file in this run
+	written := make(map[string]int)
+	var created, overwritten, skipped, failed int
+
+	start := time.Now()
+	var selected []*rss.Item
 	for _, item := range feed.Items {
-		for _, filter := range filters {
-			if strings.Contains(item.Title, filter) {
-				itemsMatchingFilters = append(itemsMatchingFilters, item)
-				break
-			}
+		if selector.Matches(item) {
+			selected = append(selected, item)
 		}
 	}
+	verboseSince(start, "matched %d of %d items", len(selected), len(feed.Items))
 
-	for _, item := range itemsMatchingFilters {
-		tmp := strings.Split(item.Title, "(")
-		tmpTags := strings.Trim(tmp[1], "()")
-		tmpTags = strings.TrimSpace(tmpTags)
-		tags := strings.Split(tmpTags, ", ")
+	var bar *progress
+	if !dryRun {
+		bar = newProgress("writing", len(selected))
+	}
+	defer bar.done()
 
-		title := strings.TrimSpace(tmp[0])
+	for _, item := range selected {
+		bar.step()
+		title, tags := splitTitle(item.Title)
 
 		meta := PageMeta{
-			Title: title,
-			Link:  item.Link,
-			Date:  item.Date,
-			Tags:  tags,
+			Title:          title,
+			CVE:            cveID(item.Title),
+			RawTitle:       item.Title,
+			RawTags:        rawTitleTags(item.Title),
+			Link:           item.Link,
+			Date:           item.Date,
+			Tags:           normalizeTags(tags, tagAliases),
+			MatchedFilters: filter.MatchedLabels(item, filters),
+			Description:    summaryDescription(item.Summary, descriptionLength),
+		}
+
+		if meta.Link == "" {
+			log.Printf("%s has no link, generating its page without one", item.Title)
+		}
+
+		summary := item.Summary
+		if maxSummaryBytes > 0 && len(summary) > maxSummaryBytes {
+			log.Printf("truncating the %d byte summary of %s to %d bytes", len(summary), itemName(meta), maxSummaryBytes)
+			summary = truncateBytes(summary, maxSummaryBytes) + truncatedSummaryNotice
 		}
 
 		data := PageData{
-			Meta:    meta,
-			Summary: item.Summary,
+			Meta:      meta,
+			Summary:   summary,
+			FeedTitle: displayFeedTitle(feed),
 		}
 
-		lowerCve := filepath.Clean(strings.ToLower(meta.Title))
-		fileName := filepath.Join(siteFilePath, "/content/cve/", (lowerCve + ".md"))
-		f, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			return err
+		pageName := itemName(meta)
+		lowerCve := filepath.Clean(strings.ToLower(pageName))
+		fileName := filepath.Join(contentDir, lowerCve+".md")
+
+		seen := written[fileName]
+		written[fileName]++
+		if seen > 0 {
+			switch onCollision {
+			case "skip":
+				log.Printf("skipping %s: %s already written by an earlier item", item.Title, fileName)
+				skipped++
+				if dryRun {
+					fmt.Printf("skip %s\n", fileName)
+				}
+				continue
+			case "suffix":
+				fileName = filepath.Join(contentDir, fmt.Sprintf("%s-%d.md", lowerCve, seen+1))
+				written[fileName]++
+				log.Printf("writing %s to %s: %s already written by an earlier item", item.Title, fileName, lowerCve+".md")
+			default:
+				log.Printf("overwriting %s with %s: already written by an earlier item", fileName, item.Title)
+			}
 		}
 
-		err = outputTemplate.Execute(f, data)
-		f.Close()
-		if err != nil {
-			return err
+		action := "create"
+		if _, err := os.Stat(fileName); err == nil || written[fileName] > 1 {
+			action = "overwrite"
+			overwritten++
+		} else {
+			created++
+		}
+
+		if dryRun {
+			fmt.Printf("%s %s\n", action, fileName)
+			continue
+		}
+
+		if err := writePage(fileName, outputTemplate, data); err != nil {
+			if failFast {
+				return err
+			}
+
+			// keep writing the remaining pages, failing once all are written
+			log.Printf("failed to write %s: %s", fileName, err)
+			recordError("output", err, item.ID)
+			failed++
 		}
 	}
 
+	if dryRun {
+		fmt.Printf("%d to create, %d to overwrite, %d to skip\n", created, overwritten, skipped)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to write %d of %d pages", failed, created+overwritten)
+	}
+
 	return nil
 }
 
+// parseGenerateTemplate returns the page template of generate. With
+// -template-dir every *.tmpl file in it is parsed into one set, so templates
+// can reference each other, and pages are rendered with the -template-name
+// template of the set.
+func parseGenerateTemplate() (*template.Template, error) {
+	if templateDir == "" {
+		return template.New("hugo").Parse(generateFormat)
+	}
+
+	set, err := template.ParseGlob(filepath.Join(templateDir, "*.tmpl"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse templates in %s: %s", templateDir, err)
+	}
+
+	tmpl := set.Lookup(templateName)
+	if tmpl == nil {
+		return nil, fmt.Errorf("template %s not found in %s%s", templateName, templateDir, set.DefinedTemplates())
+	}
+
+	return tmpl, nil
+}
+
+// writePage renders data with tmpl to the page at fileName.
+func writePage(fileName string, tmpl *template.Template, data PageData) error {
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, generateFileMode)
+	if err != nil {
+		return err
+	}
+
+	// the mode is only applied on create, overwritten pages are updated too
+	if err := f.Chmod(generateFileMode); err != nil {
+		f.Close()
+		return err
+	}
+
+	err = tmpl.Execute(f, data)
+	f.Close()
+	return err
+}
+
+// writeMatchReport writes the matches of the run to -match-report-file.
+func writeMatchReport() {
+	if runMatchReport == nil {
+		return
+	}
+
+	if err := runMatchReport.write(matchReportFile); err != nil {
+		log.Printf("failed to write match report to %s: %s", matchReportFile, err)
+		recordError("output", err, "")
+	}
+}
+
 func main() {
 	help := flag.Bool("help", false, "print help information")
+	showConfig := flag.Bool("print-config", false, "print the resolved configuration and where each value was set, then exit")
 	flag.StringVar(&feedUrl, "url", getEnvOr("SEC_FEED_URL", defaultRssFeedSource), "the url source feed")
-	flag.StringVar(&confPath, "filter-path", getEnvOr("SEC_FEED_FILTER_PATH", "conf"), "the directory path to source filters from")
+	filterPaths := newStringList(getEnvOr("SEC_FEED_FILTER_PATH", "conf"))
+	flag.Var(filterPaths, "filter-path", "a directory path to source filters from, repeatable or comma separated with later directories overriding filters of the same name")
 	flag.StringVar(&cachePath, "cache-path", getEnvOr("SEC_FEED_CACHE_PATH", ".sec-feed"), "the directory path to store all cache files")
+	cacheFormat := flag.String("cache-format", getEnvOr("SEC_FEED_CACHE_FORMAT", defaultCacheFormat), "the encoding the cache is written in, json or the smaller and faster gob")
+	flag.StringVar(&cacheFileName, "cache-file", getEnvOr("SEC_FEED_CACHE_FILE", cacheFile), "the name of the cache file within -cache-path, or an absolute path used in its place")
 	flag.StringVar(&sitePath, "site-path", getEnvOr("SEC_FEED_SITE_PATH", "site"), "the directory path to the hugo root.")
-	flag.StringVar(&formatOutput, "format", getEnvOr("SEC_FEED_OUTPUT_FORMAT", defaultOutputFormatting), "a formatting string for the resulting output data")
+	flag.StringVar(&exportPath, "export-path", getEnvOr("SEC_FEED_EXPORT_PATH", "feed.json"), "the file path the export command writes matched items to")
+	flag.StringVar(&generateFormat, "generate-format", getEnvOr("SEC_FEED_GENERATE_FORMAT", defaultGeneratedSiteFormatting), "a formatting string for the pages written by generate")
+	flag.StringVar(&formatOutput, "format", getEnvOr("SEC_FEED_OUTPUT_FORMAT", ""), "a formatting string for the resulting output data, overrides -output")
+	flag.StringVar(&outputPreset, "output", getEnvOr("SEC_FEED_OUTPUT", defaultOutputPreset), "a named output preset ("+strings.Join(listOutputPresets(), ", ")+")")
+	flag.BoolVar(&allMarksRead, "all-marks-read", getEnvBoolOr("SEC_FEED_ALL_MARKS_READ", false), "mark every item read when running all, leaving nothing for the next new run")
+	flag.IntVar(&descriptionLength, "description-length", getEnvIntOr("SEC_FEED_DESCRIPTION_LENGTH", 0), "add the summary without html, truncated to this many characters, as the description of generated pages")
+	flag.StringVar(&onlyFilter, "only-filter", getEnvOr("SEC_FEED_ONLY_FILTER", ""), "only output items matched by the filter with this name, label or name without its extension, while still caching and marking read every item")
+	flag.StringVar(&matchReportFile, "match-report-file", getEnvOr("SEC_FEED_MATCH_REPORT_FILE", ""), "write the items each filter selected during the run to this file as JSON")
+	flag.BoolVar(&splitOutput, "split-output", getEnvBoolOr("SEC_FEED_SPLIT_OUTPUT", false), "write the output of the stdout sink for each item to its own file at -output-path-template")
+	flag.StringVar(&outputPathTemplate, "output-path-template", getEnvOr("SEC_FEED_OUTPUT_PATH_TEMPLATE", ""), "the template of the file path each item is written to with -split-output, such as out/{{ cve . }}.json")
+	flag.IntVar(&maxSummaryBytes, "generate-max-summary-bytes", getEnvIntOr("SEC_FEED_GENERATE_MAX_SUMMARY_BYTES", 0), "truncate summaries longer than this many bytes in generated pages, 0 for no limit")
+	attackVectorSpec := flag.String("attack-vector", getEnvOr("SEC_FEED_ATTACK_VECTOR", ""), "only output items whose CVSS vector has one of these comma separated attack vectors (network, adjacent, local, physical)")
+	privilegesSpec := flag.String("privileges-required", getEnvOr("SEC_FEED_PRIVILEGES_REQUIRED", ""), "only output items whose CVSS vector requires one of these comma separated privilege levels (none, low, high)")
+	linkMatch := flag.String("link-match", getEnvOr("SEC_FEED_LINK_MATCH", ""), "only output items whose link matches this regular expression")
+	flag.BoolVar(&sinceLastRun, "since-last-run", getEnvBoolOr("SEC_FEED_SINCE_LAST_RUN", false), "only output items from all first fetched since all last ran with -since-last-run")
+	flag.BoolVar(&failFast, "fail-fast", getEnvBoolOr("SEC_FEED_FAIL_FAST", false), "stop generate at the first page that fails to be written rather than writing the rest first")
+	flag.BoolVar(&bom, "bom", getEnvBoolOr("SEC_FEED_BOM", false), "start -output-file, export and -split-output files with a UTF-8 byte order mark")
+	flag.StringVar(&colorMode, "color", getEnvOr("SEC_FEED_COLOR", "auto"), "when table and oneline severity symbols are colored (auto, always, never), auto honoring NO_COLOR and FORCE_COLOR")
+	flag.StringVar(&lineEnding, "line-ending", getEnvOr("SEC_FEED_LINE_ENDING", "lf"), "the line ending of -output-file, export and -split-output files (lf, crlf)")
+	flag.StringVar(&filterLabelsPath, "filter-labels", getEnvOr("SEC_FEED_FILTER_LABELS", ""), "a file of name=label lines giving filters the labels shown in notifications, stats and generated pages")
+	flag.BoolVar(&quiet, "quiet", getEnvBoolOr("SEC_FEED_QUIET", false), "don't show the progress of generate on stderr")
+	flag.StringVar(&templateDir, "template-dir", getEnvOr("SEC_FEED_TEMPLATE_DIR", ""), "a directory of *.tmpl files parsed together as the templates of generate, overriding -generate-format")
+	flag.StringVar(&templateName, "template-name", getEnvOr("SEC_FEED_TEMPLATE_NAME", "page.tmpl"), "the template of -template-dir that generated pages are rendered with")
+	fieldsSpec := flag.String("fields", getEnvOr("SEC_FEED_FIELDS", ""), "a comma separated list of the fields included by the json, ndjson and csv outputs ("+strings.Join(recordFields, ", ")+")")
+	flag.BoolVar(&renotify, "renotify-on-change", getEnvBoolOr("SEC_FEED_RENOTIFY_ON_CHANGE", false), "treat previously read items as new when their title or summary changes")
+	flag.StringVar(&onCollision, "on-collision", getEnvOr("SEC_FEED_ON_COLLISION", "overwrite"), "how generate handles items mapping to the same file (skip, suffix, overwrite)")
+	flag.BoolVar(&commitOnSuccess, "commit-on-success", getEnvBoolOr("SEC_FEED_COMMIT_ON_SUCCESS", true), "only mark new items read once they have been output successfully")
+	flag.BoolVar(&insecure, "insecure", getEnvBoolOr("SEC_FEED_INSECURE", false), "disable TLS certificate verification when fetching the feed")
+	flag.IntVar(&maxRedirects, "max-redirects", getEnvIntOr("SEC_FEED_MAX_REDIRECTS", 10), "the maximum number of redirects followed when fetching the feed")
+	headerSpecs := newStringList(getEnvOr("SEC_FEED_HEADERS", ""))
+	flag.Var(headerSpecs, "header", "a header sent with every feed request, repeatable (\"Key: Value\")")
+	flag.BoolVar(&autodiscover, "autodiscover", getEnvBoolOr("SEC_FEED_AUTODISCOVER", false), "when -url is an html page, fetch the first feed it links to")
+	flag.IntVar(&fetchRetries, "fetch-retries", getEnvIntOr("SEC_FEED_FETCH_RETRIES", 3), "how many times a rate limited or unavailable feed is retried when it sends a Retry-After header")
+	flag.DurationVar(&maxRetryWait, "max-retry-wait", getEnvDurationOr("SEC_FEED_MAX_RETRY_WAIT", time.Minute), "the longest wait before retrying a feed, however long its Retry-After header asks for")
+	flag.BoolVar(&explain, "explain", getEnvBoolOr("SEC_FEED_EXPLAIN", false), "write which filters each selected item matched, and on which field, to stderr, along with the items not selected at -verbose")
+	flag.BoolVar(&verbose, "verbose", getEnvBoolOr("SEC_FEED_VERBOSE", false), "log additional diagnostic information")
+	flag.BoolVar(&allowEmpty, "allow-empty", getEnvBoolOr("SEC_FEED_ALLOW_EMPTY", false), "allow an empty feed to update an existing cache")
+	flag.IntVar(&minItems, "min-items", getEnvIntOr("SEC_FEED_MIN_ITEMS", 0), "skip updating a cache holding more items when the fetched feed has fewer than this many")
+	sinkSpecs := newStringList(getEnvOr("SEC_FEED_SINKS", defaultSink))
+	flag.Var(sinkSpecs, "sink", "an output sink for new and all, repeatable (stdout, json-file=PATH, webhook=URL, webhook-file=PATH)")
+	flag.BoolVar(&normalizeWhitespace, "normalize-whitespace", getEnvBoolOr("SEC_FEED_NORMALIZE_WHITESPACE", false), "collapse runs of whitespace in summaries printed by new and all")
+	allowDomains = newStringList(getEnvOr("SEC_FEED_ALLOW_DOMAINS", ""))
+	flag.Var(allowDomains, "allow-domain", "only output items linking to this domain or its subdomains, repeatable")
+	denyDomains = newStringList(getEnvOr("SEC_FEED_DENY_DOMAINS", ""))
+	flag.Var(denyDomains, "deny-domain", "drop items linking to this domain or its subdomains, repeatable")
+	flag.BoolVar(&dryRun, "dry-run", getEnvBoolOr("SEC_FEED_DRY_RUN", false), "print the files generate would write without writing them or updating the cache")
+	routeSpecs := newStringList(getEnvOr("SEC_FEED_ROUTES", ""))
+	flag.Var(routeSpecs, "route", "send items with a severity or matched filter to a sink or notifier instead of -sink, repeatable (severity:critical=webhook=URL, severity:critical=pagerduty, filter:NAME=SINK)")
+	flag.StringVar(&pagerDutyRoutingKey, "pagerduty-routing-key", getEnvOr("SEC_FEED_PAGERDUTY_ROUTING_KEY", ""), "the PagerDuty Events API v2 routing key to trigger alerts for new items with")
+	flag.StringVar(&pagerDutyMinSeverity, "pagerduty-min-severity", getEnvOr("SEC_FEED_PAGERDUTY_MIN_SEVERITY", "critical"), "the minimum item severity that triggers a PagerDuty alert, any includes items of unknown severity")
+	flag.StringVar(&teamsWebhook, "teams-webhook", getEnvOr("SEC_FEED_TEAMS_WEBHOOK", ""), "a Microsoft Teams incoming webhook url to post new items to")
+	flag.StringVar(&matrixHomeserver, "matrix-homeserver", getEnvOr("SEC_FEED_MATRIX_HOMESERVER", ""), "the base url of the Matrix homeserver to post new items to")
+	flag.StringVar(&matrixToken, "matrix-token", getEnvOr("SEC_FEED_MATRIX_TOKEN", ""), "the Matrix access token used to post new items")
+	flag.StringVar(&matrixRoom, "matrix-room", getEnvOr("SEC_FEED_MATRIX_ROOM", ""), "the Matrix room id to post new items to")
+	flag.IntVar(&notifyRate, "notify-rate", getEnvIntOr("SEC_FEED_NOTIFY_RATE", 0), "the maximum number of notifications sent per minute, 0 for unlimited")
+	flag.IntVar(&notifyMaxPerRun, "notify-max-per-run", getEnvIntOr("SEC_FEED_NOTIFY_MAX_PER_RUN", 0), "the maximum number of items notified per run before summarizing the rest, 0 for unlimited")
+	flag.StringVar(&notifyLogPath, "notify-log-path", getEnvOr("SEC_FEED_NOTIFY_LOG_PATH", ""), "a file recording notified items so they are never notified twice, even if the cache is cleared")
+	flag.DurationVar(&notifyLogRetention, "notify-log-retention", getEnvDurationOr("SEC_FEED_NOTIFY_LOG_RETENTION", 30*24*time.Hour), "how long notified items are remembered in the notification log, 0 to keep them forever")
+	flag.StringVar(&notifyTemplate, "notify-template", getEnvOr("SEC_FEED_NOTIFY_TEMPLATE", ""), "a formatting string for webhook, Teams and Matrix notification messages")
+	flag.StringVar(&notifyTemplateFile, "notify-template-file", getEnvOr("SEC_FEED_NOTIFY_TEMPLATE_FILE", ""), "a file containing the notification message template")
+	flag.StringVar(&jiraURL, "jira-url", getEnvOr("SEC_FEED_JIRA_URL", ""), "the base url of a JIRA instance to create issues for new items in")
+	flag.StringVar(&jiraProject, "jira-project", getEnvOr("SEC_FEED_JIRA_PROJECT", ""), "the key of the JIRA project issues are created in")
+	flag.StringVar(&jiraIssueType, "jira-issue-type", getEnvOr("SEC_FEED_JIRA_ISSUE_TYPE", "Bug"), "the type of JIRA issues created")
+	flag.StringVar(&jiraUser, "jira-user", getEnvOr("SEC_FEED_JIRA_USER", ""), "the JIRA user authenticating with -jira-token, leave empty to send the token as a bearer token")
+	flag.StringVar(&jiraToken, "jira-token", getEnvOr("SEC_FEED_JIRA_TOKEN", ""), "the JIRA api or personal access token")
+	flag.StringVar(&jiraMinSeverity, "jira-min-severity", getEnvOr("SEC_FEED_JIRA_MIN_SEVERITY", "high"), "the minimum item severity that creates a JIRA issue, any includes items of unknown severity")
+	flag.StringVar(&gitHubRepo, "github-repo", getEnvOr("SEC_FEED_GITHUB_REPO", ""), "an owner/name GitHub repository to open issues for new items in")
+	flag.StringVar(&gitHubToken, "github-token", getEnvOr("SEC_FEED_GITHUB_TOKEN", ""), "the GitHub token used to open issues")
+	flag.StringVar(&gitHubAPIURL, "github-api-url", getEnvOr("SEC_FEED_GITHUB_API_URL", defaultGitHubAPIURL), "the GitHub api base url")
+	flag.StringVar(&gitHubMinSeverity, "github-min-severity", getEnvOr("SEC_FEED_GITHUB_MIN_SEVERITY", "any"), "the minimum item severity that opens a GitHub issue, any includes items of unknown severity")
+	flag.BoolVar(&openLinks, "open", getEnvBoolOr("SEC_FEED_OPEN", false), "open the link of each item output by new and all in the default browser")
+	flag.IntVar(&openLimit, "open-limit", getEnvIntOr("SEC_FEED_OPEN_LIMIT", 10), "ask for confirmation before -open opens more than this many links, 0 to never ask")
+	flag.StringVar(&afterGUID, "after-guid", getEnvOr("SEC_FEED_AFTER_GUID", ""), "only output items published after the item with this guid from all")
+	flag.StringVar(&errorFile, "error-file", getEnvOr("SEC_FEED_ERROR_FILE", ""), "append a JSON summary of the run's errors to this file, - for stderr")
+	flag.StringVar(&feedTitle, "feed-title", getEnvOr("SEC_FEED_FEED_TITLE", ""), "a title replacing the source feed's title in generated pages")
+	flag.DurationVar(&maxAge, "max-age", getEnvDurationOr("SEC_FEED_MAX_AGE", 0), "drop items published longer than this ago, even if unread, 0 to keep every item")
+	flag.DurationVar(&autoReadAge, "auto-read-age", getEnvDurationOr("SEC_FEED_AUTO_READ_AGE", 0), "mark unread items published longer than this ago as read without outputting them, 0 to never mark items read by age")
+	flag.BoolVar(&keepUndated, "keep-undated", getEnvBoolOr("SEC_FEED_KEEP_UNDATED", true), "keep items without a publication date when -max-age is set")
+	flag.BoolVar(&allowMissingFilters, "allow-missing-filters", getEnvBoolOr("SEC_FEED_ALLOW_MISSING_FILTERS", false), "continue without filters when the -filter-path directory doesn't exist")
+	flag.IntVar(&topItems, "top", getEnvIntOr("SEC_FEED_TOP", 0), "only output this many of the highest scoring items from new and all, 0 to output every item")
+	flag.IntVar(&filterWeight, "score-filter-weight", getEnvIntOr("SEC_FEED_SCORE_FILTER_WEIGHT", 1), "the score added to an item for each filter it matches")
+	flag.IntVar(&severityWeight, "score-severity-weight", getEnvIntOr("SEC_FEED_SCORE_SEVERITY_WEIGHT", 1), "the score added to an item per severity rating above none, from low to critical")
+	flag.StringVar(&outputFile, "output-file", getEnvOr("SEC_FEED_OUTPUT_FILE", ""), "write the output of the stdout sink to this file or FIFO instead of stdout")
+	flag.DurationVar(&fifoTimeout, "fifo-timeout", getEnvDurationOr("SEC_FEED_FIFO_TIMEOUT", 5*time.Second), "how long to wait for a reader when -output-file is a FIFO before writing to stdout")
+	flag.BoolVar(&resetMatching, "reset-matching", getEnvBoolOr("SEC_FEED_RESET_MATCHING", false), "only mark items matching the filters unread with reset-read")
+	flag.StringVar(&resetSince, "reset-since", getEnvOr("SEC_FEED_RESET_SINCE", ""), "only mark items published after this date (YYYY-MM-DD or RFC3339) unread with reset-read")
+	flag.BoolVar(&noCache, "no-cache", getEnvBoolOr("SEC_FEED_NO_CACHE", false), "always fetch the live feed and never read or update the cache, new then outputs every matching item")
+	cacheFileMode = getEnvFileModeOr("SEC_FEED_CACHE_FILE_MODE", 0644)
+	flag.Var(fileModeValue{&cacheFileMode}, "cache-file-mode", "the octal permissions of the cache files")
+	generateFileMode = getEnvFileModeOr("SEC_FEED_GENERATE_FILE_MODE", 0644)
+	flag.Var(fileModeValue{&generateFileMode}, "generate-file-mode", "the octal permissions of the pages written by generate")
+	dirMode = getEnvFileModeOr("SEC_FEED_DIR_MODE", 0755)
+	flag.Var(fileModeValue{&dirMode}, "dir-mode", "the octal permissions of the cache and generated page directories when created")
+	flag.StringVar(&tagAliasesPath, "tag-aliases", getEnvOr("SEC_FEED_TAG_ALIASES", ""), "a file of alias=tag lines mapping tag synonyms in generated pages to one tag")
+	flag.StringVar(&tagSeparator, "tag-separator", getEnvOr("SEC_FEED_TAG_SEPARATOR", defaultTagSeparator), "the separator between the tags in the parenthetical group of titles")
+	flag.BoolVar(&appendOutput, "append", getEnvBoolOr("SEC_FEED_APPEND", false), "append to -output-file and the export file rather than replacing them")
+	flag.DurationVar(&lockTimeout, "lock-timeout", getEnvDurationOr("SEC_FEED_LOCK_TIMEOUT", 30*time.Second), "how long to wait for another run holding the cache lock before exiting")
+	configPath := flag.String("config", getEnvOr("SEC_FEED_CONFIG", ""), "a JSON config file defining profiles")
+	profile := flag.String("profile", getEnvOr("SEC_FEED_PROFILE", ""), "the profile from -config whose settings are applied, overridden by explicit flags")
+	secretFiles := registerSecretFileFlags(flag.CommandLine)
 	flag.Parse()
 
+	if *profile != "" {
+		if *configPath == "" {
+			fatal("config", fmt.Errorf("-profile %s requires a -config file", *profile))
+		}
+
+		cfg, err := loadConfigFile(*configPath)
+		if err != nil {
+			fatal("config", err)
+		}
+
+		if err := applyProfile(flag.CommandLine, cfg, *profile); err != nil {
+			fatal("config", err)
+		}
+	}
+
+	if err := loadSecretFiles(flag.CommandLine, secretFiles); err != nil {
+		fatal("config", err)
+	}
+
 	if *help {
 		printHelp()
 		os.Exit(0)
 	}
 
-	absoluteCacheFilePath := filepath.Join(cachePath, cacheFile)
-	filters, err := WalkAllFilesInFilterDir(filepath.Clean(confPath))
+	if *showConfig {
+		if err := printConfig(flag.CommandLine); err != nil {
+			fatal("config", err)
+		}
+		os.Exit(0)
+	}
+
+	fields, err := parseFields(*fieldsSpec)
+	if err != nil {
+		fatal("config", err)
+	}
+	outputFields = fields
+
+	if *linkMatch != "" {
+		if linkPattern, err = regexp.Compile(*linkMatch); err != nil {
+			fatal("config", fmt.Errorf("invalid -link-match pattern: %s", err))
+		}
+	}
+
+	if cacheEncoding, err = cacheCodecFor(*cacheFormat); err != nil {
+		fatal("config", err)
+	}
+
+	if attackVectors, err = parseCVSSValues(*attackVectorSpec, "AV"); err != nil {
+		fatal("config", fmt.Errorf("invalid -attack-vector: %s", err))
+	}
+
+	if privilegesRequired, err = parseCVSSValues(*privilegesSpec, "PR"); err != nil {
+		fatal("config", fmt.Errorf("invalid -privileges-required: %s", err))
+	}
+
+	switch onCollision {
+	case "skip", "suffix", "overwrite":
+	default:
+		fatal("config", fmt.Errorf("invalid collision mode: %s", onCollision))
+	}
+
+	if insecure {
+		log.Println("WARNING: TLS certificate verification is disabled, feed contents can be intercepted or forged. Do not use -insecure outside of testing.")
+	}
+	headers, err := parseHeaders(headerSpecs.values)
+	if err != nil {
+		fatal("config", err)
+	}
+	client := newFetchClient(insecure, maxRedirects, headers)
+
+	absoluteCacheFilePath := cacheFilePath(cachePath, cacheFileName)
+	// a dry run of generate only reads the cache, so it neither creates the
+	// cache directory nor waits on a run that holds the lock.
+	if !noCache && !(dryRun && flag.Arg(0) == "generate") {
+		if err := os.MkdirAll(cachePath, dirMode); err != nil {
+			fatal("config", fmt.Errorf("failed to create cache directory %s: %s", cachePath, err))
+		} else if err := os.MkdirAll(filepath.Dir(absoluteCacheFilePath), dirMode); err != nil {
+			fatal("config", fmt.Errorf("failed to create cache directory %s: %s", filepath.Dir(absoluteCacheFilePath), err))
+		}
+
+		// overlapping runs would each update the cache from the same state,
+		// losing the read state and notifications of all but the last.
+		lockPath := cacheLockPath(cachePath, absoluteCacheFilePath)
+		if err := lockCache(lockPath, lockTimeout); err != nil {
+			fatal("lock", fmt.Errorf("failed to lock the cache, is another run in progress? %s", err))
+		}
+		defer cacheLock.Close()
+	}
+
+	var filterDirs []string
+	for _, value := range filterPaths.values {
+		for _, dir := range strings.Split(value, ",") {
+			if dir = strings.TrimSpace(dir); dir != "" {
+				filterDirs = append(filterDirs, filepath.Clean(dir))
+			}
+		}
+	}
+
+	filterGroups, disabledFilters, err := filter.WalkDirs(filterDirs, filter.WalkOptions{
+		AllowMissing: allowMissingFilters,
+		Warnf: func(format string, v ...interface{}) {
+			log.Printf("WARNING: "+format, v...)
+		},
+		Verbosef: verbosef,
+	})
+	var notFound *filter.ErrDirNotFound
+	if errors.As(err, &notFound) {
+		fatal("filters", fmt.Errorf("%s, check -filter-path or set -allow-missing-filters to run without filters", err))
+	} else if err != nil {
+		fatal("filters", fmt.Errorf("failed to load vulnerability filters: %s", err))
+	}
+	var filterLabels map[string]string
+	if filterLabelsPath != "" {
+		if filterLabels, err = filter.LoadLabels(filterLabelsPath); err != nil {
+			fatal("filters", fmt.Errorf("failed to load filter labels: %s", err))
+		}
+	}
+
+	filters := filter.Build(filterGroups, filterLabels, tagSeparator)
+	var disabledLabels []string
+	for _, name := range disabledFilters {
+		verbosef("filter %s is disabled", name)
+		disabledLabels = append(disabledLabels, filter.Label(name, filterLabels))
+	}
+	scoredFilters = filters
+
+	if _, err := filter.Find(filters, onlyFilter); onlyFilter != "" && err != nil {
+		fatal("filters", fmt.Errorf("invalid -only-filter in %s: %s", strings.Join(filterDirs, ", "), err))
+	}
+
+	if matchReportFile != "" {
+		runMatchReport = newMatchReport(filters)
+	}
+
+	if outputFile != "" && appendOutput {
+		if err := checkAppendable(outputPreset, formatOutput, splitOutput); err != nil {
+			fatal("config", err)
+		}
+	}
+
+	if outputFile != "" {
+		w, lock, err := openOutputFile(outputFile, appendOutput, fifoTimeout)
+		if err != nil {
+			fatal("config", fmt.Errorf("failed to open output file %s: %s", outputFile, err))
+		}
+
+		// deferred first so the lock is only released once the output, flushed
+		// by every command, has been closed
+		if outputLock = lock; outputLock != nil {
+			defer outputLock.Close()
+		}
+
+		if f, ok := w.(*os.File); ok && f != os.Stdout {
+			defer f.Close()
+		}
+
+		stdout.Reset(newEncodingWriter(w))
+	}
+
+	if sinceLastRun && noCache {
+		fatal("config", fmt.Errorf("-since-last-run requires the cache, it cannot be used with -no-cache"))
+	}
+
+	switch colorMode {
+	case "auto", "always", "never":
+	default:
+		fatal("config", fmt.Errorf("invalid color %s, expected auto, always or never", colorMode))
+	}
+
+	switch lineEnding {
+	case "lf", "crlf":
+	default:
+		fatal("config", fmt.Errorf("invalid line ending %s, expected lf or crlf", lineEnding))
+	}
+
+	if splitOutput && outputPathTemplate == "" {
+		fatal("config", fmt.Errorf("-split-output requires an -output-path-template"))
+	}
+
+	notices, err := newNotifications()
+	if err != nil {
+		fatal("config", err)
+	}
+
+	notifiers, err := newNotifiers(filters, notices)
 	if err != nil {
-		log.Fatal("failed to vulnerability filters.")
+		fatal("config", err)
+	}
+
+	sinks, err := newSinks(sinkSpecs.values, notices)
+	if err != nil {
+		fatal("config", err)
+	}
+
+	if len(routeSpecs.values) > 0 {
+		// only the new command notifies, other commands drop notifier routes
+		routed := notifiers
+		if flag.Arg(0) != "new" {
+			routed = nil
+		}
+
+		router, err := newRoutingSink(routeSpecs.values, sinks, filters, routed, notices)
+		if err != nil {
+			fatal("config", err)
+		}
+
+		sinks = []sink{router}
+	}
+
+	if topItems > 0 {
+		sinks = []sink{&topSink{n: topItems, filters: filters, sinks: sinks}}
+	}
+
+	if openLinks {
+		sinks = append(sinks, &browserSink{limit: openLimit})
 	}
 
 	cmd := flag.Arg(0)
 	switch cmd {
 	case "new":
-		feed, cached, err := fetch_feed(feedUrl, absoluteCacheFilePath, false)
+		feed, cached, err := fetch_feed(client, feedUrl, absoluteCacheFilePath, false, renotify)
 		if err != nil {
-			log.Fatal(err)
+			fatal("fetch", err)
 		}
 
-		err = cmdNewItems(feed, absoluteCacheFilePath, filters, cached)
+		sinks = append(sinks, notices.notifierSinks(notifiers)...)
+		if !noCache {
+			statsSink, err := newFilterStatsSink(filepath.Join(cachePath, filterStatsFile), filters)
+			if err != nil {
+				fatal("output", err)
+			}
+
+			sinks = append(sinks, statsSink)
+		}
+
+		err = cmdNewItems(feed, absoluteCacheFilePath, filters, cached, sinks)
+		writeMatchReport()
+		stdout.Flush()
 		if err != nil {
-			log.Fatal(err)
+			abortSinks(sinks)
+			fatal("output", err)
 		}
 	case "all":
-		feed, _, err := fetch_feed(feedUrl, absoluteCacheFilePath, true)
+		feed, _, err := fetch_feed(client, feedUrl, absoluteCacheFilePath, true, renotify)
 		if err != nil {
-			log.Fatal(err)
+			fatal("fetch", err)
 		}
 
-		err = cmdAll(feed, absoluteCacheFilePath, filters)
+		err = cmdAll(feed, absoluteCacheFilePath, filters, afterGUID, sinceLastRun, sinks)
+		writeMatchReport()
+		stdout.Flush()
 		if err != nil {
-			log.Fatal(err)
+			abortSinks(sinks)
+			fatal("output", err)
 		}
 	case "generate":
-		feed, _, err := fetch_feed(feedUrl, absoluteCacheFilePath, true)
+		feed, _, err := fetch_feed(client, feedUrl, absoluteCacheFilePath, true, renotify)
+		if err != nil {
+			fatal("fetch", err)
+		}
+
+		var tagAliases map[string]string
+		if tagAliasesPath != "" {
+			if tagAliases, err = loadTagAliases(tagAliasesPath); err != nil {
+				fatal("config", fmt.Errorf("failed to load tag aliases: %s", err))
+			}
+		}
+
+		err = cmdGenerate(feed, absoluteCacheFilePath, filepath.Clean(sitePath), filters, tagAliases, dryRun)
+		writeMatchReport()
+		if err != nil {
+			fatal("output", err)
+		}
+	case "export":
+		feed, _, err := fetch_feed(client, feedUrl, absoluteCacheFilePath, true, renotify)
 		if err != nil {
-			log.Fatal(err)
+			fatal("fetch", err)
 		}
 
-		err = cmdGenerate(feed, absoluteCacheFilePath, filepath.Clean(sitePath), filters)
+		err = cmdExport(feed, absoluteCacheFilePath, filepath.Clean(exportPath), filters, appendOutput)
+		writeMatchReport()
 		if err != nil {
-			log.Fatal(err)
+			fatal("output", err)
+		}
+	case "stats":
+		if err := cmdStats(os.Stdout, filepath.Join(cachePath, filterStatsFile), filters, disabledLabels); err != nil {
+			fatal("output", err)
+		}
+	case "reset-read":
+		var since time.Time
+		if resetSince != "" {
+			if since, err = parseDate(resetSince); err != nil {
+				fatal("config", fmt.Errorf("invalid -reset-since date %s: %s", resetSince, err))
+			}
+		}
+
+		if err := cmdResetRead(absoluteCacheFilePath, filters, resetMatching, since); err != nil {
+			fatal("output", err)
 		}
 
 	case "":
-		log.Fatal("command not specified")
+		fatal("command", errors.New("command not specified"))
 	default:
-		log.Fatalf("invalid command: %s", cmd)
+		fatal("command", fmt.Errorf("invalid command: %s", cmd))
+	}
+
+	if err := writeErrorSummary(errorFile); err != nil {
+		log.Printf("failed to write error summary to %s: %s", errorFile, err)
 	}
 }
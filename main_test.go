@@ -0,0 +1,639 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/SlyMarbo/rss"
+	"github.com/ncatelli/sec-feed/filter"
+)
+
+// TestMain sets up the flag values that main would otherwise initialize.
+func TestMain(m *testing.M) {
+	allowDomains = newStringList("")
+	denyDomains = newStringList("")
+
+	os.Exit(m.Run())
+}
+
+// useTestCache points the cache globals at their defaults for the test.
+func useTestCache(t *testing.T) {
+	prevEncoding, prevMode := cacheEncoding, cacheFileMode
+	cacheEncoding, cacheFileMode = jsonCacheCodec{}, 0644
+	t.Cleanup(func() {
+		cacheEncoding, cacheFileMode = prevEncoding, prevMode
+	})
+}
+
+func TestCmdExportKeepsUnread(t *testing.T) {
+	useTestCache(t)
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, cacheFile)
+
+	feed := &cachedFeed{Feed: &rss.Feed{
+		Items: []*rss.Item{
+			{ID: "1", Title: "CVE-2021-0001 (openssl)"},
+			{ID: "2", Title: "CVE-2021-0002 (nginx)"},
+			{ID: "3", Title: "CVE-2021-0003 (openssl)", Read: true},
+		},
+		Unread: 2,
+	}}
+	filters := filter.Build(map[string][]string{"openssl": {"openssl"}}, nil, "")
+
+	if err := cmdExport(feed, cachePath, filepath.Join(dir, "feed.json"), filters, false); err != nil {
+		t.Fatalf("cmdExport() error = %s", err)
+	}
+
+	cached, err := loadCachedFeed(cachePath)
+	if err != nil {
+		t.Fatalf("loadCachedFeed() error = %s", err)
+	}
+
+	for _, f := range []*cachedFeed{feed, cached} {
+		if f.Unread != 2 {
+			t.Errorf("Unread = %d after export, want 2", f.Unread)
+		}
+
+		for _, item := range f.Items {
+			if want := item.ID == "3"; item.Read != want {
+				t.Errorf("item %s Read = %t after export, want %t", item.ID, item.Read, want)
+			}
+		}
+	}
+}
+
+// testFeedServer serves an RSS feed holding an item per id, each with
+// summary, or fails with status when it isn't 200.
+type testFeedServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	ids     []string
+	summary string
+	status  int
+}
+
+func newTestFeedServer(t *testing.T, ids ...string) *testFeedServer {
+	s := &testFeedServer{ids: ids, status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.status != http.StatusOK {
+			w.WriteHeader(s.status)
+			return
+		}
+
+		var sb strings.Builder
+		sb.WriteString(`<?xml version="1.0"?><rss version="2.0"><channel><title>test feed</title><description>fixture</description>`)
+		for _, id := range s.ids {
+			fmt.Fprintf(&sb, `<item><title>CVE-2021-%s (openssl)</title><link>https://example.com/%s</link><guid>%s</guid><description>%s</description></item>`, id, id, id, s.summary)
+		}
+		sb.WriteString(`</channel></rss>`)
+
+		w.Header().Set("Content-Type", "application/rss+xml")
+		io.WriteString(w, sb.String())
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// serve changes the response of the server to status, or to a feed of ids
+// when status is 200.
+func (s *testFeedServer) serve(status int, ids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status, s.ids = status, ids
+}
+
+// revise changes the summary of every item served.
+func (s *testFeedServer) revise(summary string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.summary = summary
+}
+
+// seedTestCache caches the feed served by srv with every item read, due to
+// refresh on the next fetch.
+func seedTestCache(t *testing.T, srv *testFeedServer, cachePath string) {
+	feed, _, err := fetch_feed(srv.Client(), srv.URL, cachePath, false, false)
+	if err != nil {
+		t.Fatalf("seeding the cache: fetch_feed() error = %s", err)
+	}
+
+	feed.Refresh = time.Now().Add(-time.Minute)
+	if err := cacheFeed(cachePath, feed); err != nil {
+		t.Fatalf("seeding the cache: cacheFeed() error = %s", err)
+	}
+}
+
+// itemIDs returns the ids of the items of feed, with the unread ones marked
+// with a trailing *.
+func itemIDs(feed *cachedFeed) string {
+	var ids []string
+	for _, item := range feed.Items {
+		id := item.ID
+		if !item.Read {
+			id += "*"
+		}
+		ids = append(ids, id)
+	}
+
+	return strings.Join(ids, ",")
+}
+
+func TestUpdateFeedRenotify(t *testing.T) {
+	tests := []struct {
+		name     string
+		renotify bool
+		summary  string
+		ids      []string
+		want     string
+		unread   uint32
+	}{
+		{name: "unchanged", renotify: true, summary: "a flaw", ids: []string{"1", "2"}, want: "1,2"},
+		{name: "revised without renotify", renotify: false, summary: "a revised flaw", ids: []string{"1", "2"}, want: "1,2"},
+		{name: "revised", renotify: true, summary: "a revised flaw", ids: []string{"1", "2"}, want: "1*,2*", unread: 2},
+		{name: "new item", renotify: false, summary: "a flaw", ids: []string{"1", "2", "3"}, want: "1,2,3*", unread: 1},
+		{name: "new and revised", renotify: true, summary: "a revised flaw", ids: []string{"1", "3"}, want: "1*,2,3*", unread: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestCache(t)
+			cachePath := filepath.Join(t.TempDir(), cacheFile)
+			srv := newTestFeedServer(t, "1", "2")
+			srv.revise("a flaw")
+			seedTestCache(t, srv, cachePath)
+
+			feed, err := loadCachedFeed(cachePath)
+			if err != nil {
+				t.Fatalf("loadCachedFeed() error = %s", err)
+			}
+
+			srv.serve(http.StatusOK, tt.ids...)
+			srv.revise(tt.summary)
+			if err := updateFeed(srv.Client(), feed, tt.renotify); err != nil {
+				t.Fatalf("updateFeed() error = %s", err)
+			}
+
+			if got := itemIDs(feed); got != tt.want || feed.Unread != tt.unread {
+				t.Errorf("updateFeed() items = %s with %d unread, want %s with %d", got, feed.Unread, tt.want, tt.unread)
+			}
+
+			for _, item := range feed.Items {
+				if !item.Read && item.ID != "3" && item.Summary != tt.summary {
+					t.Errorf("re-notified item %s summary = %q, want the revision %q", item.ID, item.Summary, tt.summary)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchFeedCacheMiss(t *testing.T) {
+	useTestCache(t)
+	srv := newTestFeedServer(t, "1", "2")
+
+	feed, cached, err := fetch_feed(srv.Client(), srv.URL, filepath.Join(t.TempDir(), cacheFile), false, false)
+	if err != nil {
+		t.Fatalf("fetch_feed() error = %s", err)
+	}
+
+	if cached {
+		t.Error("fetch_feed() reported a cached feed without a cache")
+	}
+
+	if got := itemIDs(feed); got != "1*,2*" {
+		t.Errorf("fetch_feed() items = %s, want 1*,2*", got)
+	}
+
+	if len(feed.FirstSeen) != 2 {
+		t.Errorf("fetch_feed() recorded %d first seen times, want 2", len(feed.FirstSeen))
+	}
+}
+
+func TestFetchFeedCacheHitUpdate(t *testing.T) {
+	useTestCache(t)
+	cachePath := filepath.Join(t.TempDir(), cacheFile)
+	srv := newTestFeedServer(t, "1", "2")
+	seedTestCache(t, srv, cachePath)
+
+	srv.serve(http.StatusOK, "2", "3")
+	feed, cached, err := fetch_feed(srv.Client(), srv.URL, cachePath, false, false)
+	if err != nil {
+		t.Fatalf("fetch_feed() error = %s", err)
+	}
+
+	if !cached {
+		t.Error("fetch_feed() didn't report the cached feed")
+	}
+
+	if got := itemIDs(feed); got != "1,2,3*" {
+		t.Errorf("fetch_feed() items = %s, want 1,2,3*", got)
+	}
+
+	if feed.Unread != 1 {
+		t.Errorf("fetch_feed() Unread = %d, want 1", feed.Unread)
+	}
+}
+
+func TestFetchFeedUpdateFailureIgnored(t *testing.T) {
+	useTestCache(t)
+	cachePath := filepath.Join(t.TempDir(), cacheFile)
+	srv := newTestFeedServer(t, "1", "2")
+	seedTestCache(t, srv, cachePath)
+
+	srv.serve(http.StatusInternalServerError)
+	feed, cached, err := fetch_feed(srv.Client(), srv.URL, cachePath, true, false)
+	if err != nil {
+		t.Fatalf("fetch_feed() error = %s, want the cached feed", err)
+	}
+
+	if !cached {
+		t.Error("fetch_feed() didn't report the cached feed")
+	}
+
+	if got := itemIDs(feed); got != "1,2" {
+		t.Errorf("fetch_feed() items = %s, want the cached 1,2", got)
+	}
+}
+
+func TestFetchFeedNoCache(t *testing.T) {
+	useTestCache(t)
+	cachePath := filepath.Join(t.TempDir(), cacheFile)
+	srv := newTestFeedServer(t, "1", "2")
+	seedTestCache(t, srv, cachePath)
+
+	noCache = true
+	t.Cleanup(func() {
+		noCache = false
+	})
+
+	srv.serve(http.StatusOK, "3")
+	feed, cached, err := fetch_feed(srv.Client(), srv.URL, cachePath, false, false)
+	if err != nil {
+		t.Fatalf("fetch_feed() error = %s", err)
+	}
+
+	if cached {
+		t.Error("fetch_feed() reported a cached feed with -no-cache")
+	}
+
+	if got := itemIDs(feed); got != "3*" {
+		t.Errorf("fetch_feed() items = %s, want only the upstream 3*", got)
+	}
+}
+
+func TestFetchFeedFailures(t *testing.T) {
+	tests := []struct {
+		name         string
+		seed         bool
+		cacheData    string
+		ignoreUpdate bool
+	}{
+		{name: "cache miss, fetch fails", ignoreUpdate: true},
+		{name: "cache hit, update fails", seed: true},
+		{name: "cache holds no feed", cacheData: "{}", ignoreUpdate: true},
+		{name: "cache is corrupt", cacheData: "{", ignoreUpdate: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestCache(t)
+			cachePath := filepath.Join(t.TempDir(), cacheFile)
+			srv := newTestFeedServer(t, "1", "2")
+			if tt.seed {
+				seedTestCache(t, srv, cachePath)
+			} else if tt.cacheData != "" {
+				if err := os.WriteFile(cachePath, []byte(tt.cacheData), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			srv.serve(http.StatusInternalServerError)
+			feed, cached, err := fetch_feed(srv.Client(), srv.URL, cachePath, tt.ignoreUpdate, false)
+			if err == nil {
+				t.Fatalf("fetch_feed() = %d items, want an error", len(feed.Items))
+			}
+
+			if feed != nil || cached {
+				t.Errorf("fetch_feed() = %v, %t with error %s, want no feed", feed, cached, err)
+			}
+		})
+	}
+}
+
+// discardSink counts the items written to it.
+type discardSink struct {
+	items int
+}
+
+func (s *discardSink) Write(item *rss.Item) error {
+	s.items++
+	return nil
+}
+
+func (s *discardSink) Flush() error {
+	return nil
+}
+
+// benchmarkFeed returns 500 filters and a cached feed of 5000 items, half of
+// which match one of the filters.
+func benchmarkFeed() ([]filter.Filter, *cachedFeed) {
+	groups := make(map[string][]string, 500)
+	for i := 0; i < 500; i++ {
+		term := fmt.Sprintf("prod%03d_lib", i)
+		groups[term] = []string{term}
+	}
+
+	feed := &cachedFeed{Feed: &rss.Feed{Items: make([]*rss.Item, 5000)}}
+	for i := range feed.Items {
+		feed.Items[i] = &rss.Item{
+			ID:    fmt.Sprint(i),
+			Title: fmt.Sprintf("CVE-2021-%05d (vendor%02d, prod%03d_lib)", i, i%97, i%1000),
+			Link:  fmt.Sprintf("https://example.com/%d", i),
+		}
+	}
+
+	return filter.Build(groups, nil, ""), feed
+}
+
+func BenchmarkCmdAll(b *testing.B) {
+	filters, feed := benchmarkFeed()
+	noCache = true
+	defer func() {
+		noCache = false
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		out := &discardSink{}
+		if err := cmdAll(feed, "", filters, "", false, []sink{out}); err != nil {
+			b.Fatal(err)
+		} else if out.items != 2500 {
+			b.Fatalf("cmdAll() wrote %d items, want 2500", out.items)
+		}
+	}
+}
+
+// BenchmarkCollectThenWrite matches the same items into an intermediate
+// slice before writing them, as cmdAll did before matching and writing in a
+// single pass.
+func BenchmarkCollectThenWrite(b *testing.B) {
+	filters, feed := benchmarkFeed()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		selector := newItemSelector(filters)
+		var matching []*rss.Item
+		for _, item := range feed.Items {
+			if selector.Matches(item) {
+				matching = append(matching, item)
+			}
+		}
+
+		sinks := []sink{&discardSink{}}
+		for _, item := range matching {
+			if err := writeToSinks(sinks, item); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// useTestSite sets the generate globals to write pages holding the title and
+// summary of each item.
+func useTestSite(t *testing.T) {
+	useTestCache(t)
+	prevFormat, prevFileMode, prevDirMode, prevQuiet := generateFormat, generateFileMode, dirMode, quiet
+	generateFormat, generateFileMode, dirMode, quiet = "{{ .Meta.Title }}\n{{ .Summary }}\n", 0644, 0755, true
+	t.Cleanup(func() {
+		generateFormat, generateFileMode, dirMode, quiet = prevFormat, prevFileMode, prevDirMode, prevQuiet
+	})
+}
+
+// readPages returns the content of each page generated in site by file name.
+func readPages(t *testing.T, site string) map[string]string {
+	dir := filepath.Join(site, "content", "cve")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("reading generated pages: %s", err)
+	}
+
+	pages := make(map[string]string)
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatalf("reading generated page: %s", err)
+		}
+		pages[entry.Name()] = string(data)
+	}
+
+	return pages
+}
+
+func TestCmdGenerateCollisions(t *testing.T) {
+	tests := []struct {
+		onCollision string
+		want        map[string]string
+	}{
+		{onCollision: "overwrite", want: map[string]string{
+			"cve-2021-0001.md": "CVE-2021-0001\nsecond\n",
+		}},
+		{onCollision: "skip", want: map[string]string{
+			"cve-2021-0001.md": "CVE-2021-0001\nfirst\n",
+		}},
+		{onCollision: "suffix", want: map[string]string{
+			"cve-2021-0001.md":   "CVE-2021-0001\nfirst\n",
+			"cve-2021-0001-2.md": "CVE-2021-0001\nsecond\n",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.onCollision, func(t *testing.T) {
+			useTestSite(t)
+			prev := onCollision
+			onCollision = tt.onCollision
+			t.Cleanup(func() { onCollision = prev })
+
+			dir := t.TempDir()
+			site := filepath.Join(dir, "site")
+			// both titles slugify to the page of their CVE
+			feed := &cachedFeed{Feed: &rss.Feed{Items: []*rss.Item{
+				{ID: "1", Title: "CVE-2021-0001 (openssl)", Summary: "first"},
+				{ID: "2", Title: "CVE-2021-0001 (openssl, debian)", Summary: "second"},
+			}}}
+			filters := filter.Build(map[string][]string{"openssl": {"openssl"}}, nil, "")
+
+			if err := cmdGenerate(feed, filepath.Join(dir, cacheFile), site, filters, nil, false); err != nil {
+				t.Fatalf("cmdGenerate() error = %s", err)
+			}
+
+			if got := readPages(t, site); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("generated pages = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCmdNewItemsCommitOnSuccess(t *testing.T) {
+	tests := []struct {
+		name            string
+		commitOnSuccess bool
+		format          string
+		wantErr         bool
+		want            string
+	}{
+		{name: "output", commitOnSuccess: true, format: "{{ .Title }}\n", want: "1,2"},
+		{name: "template error", commitOnSuccess: true, format: "{{ index .Categories 1 }}\n", wantErr: true, want: "1*,2*"},
+		{name: "template error without commit-on-success", commitOnSuccess: false, format: "{{ index .Categories 1 }}\n", wantErr: true, want: "1,2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestCache(t)
+			prev := commitOnSuccess
+			commitOnSuccess = tt.commitOnSuccess
+			t.Cleanup(func() { commitOnSuccess = prev })
+
+			cachePath := filepath.Join(t.TempDir(), cacheFile)
+			feed := &cachedFeed{Feed: &rss.Feed{
+				Items: []*rss.Item{
+					{ID: "1", Title: "CVE-2021-0001 (openssl)"},
+					{ID: "2", Title: "CVE-2021-0002 (openssl)"},
+				},
+				Unread: 2,
+			}}
+			if err := storeFeed(cachePath, feed); err != nil {
+				t.Fatalf("storeFeed() error = %s", err)
+			}
+
+			out := &templateSink{
+				w:    bufio.NewWriter(io.Discard),
+				tmpl: template.Must(template.New("output").Parse(tt.format)),
+			}
+			filters := filter.Build(map[string][]string{"openssl": {"openssl"}}, nil, "")
+
+			err := cmdNewItems(feed, cachePath, filters, true, []sink{out})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("cmdNewItems() error = %v, want error %t", err, tt.wantErr)
+			}
+
+			cached, err := loadCachedFeed(cachePath)
+			if err != nil {
+				t.Fatalf("loadCachedFeed() error = %s", err)
+			}
+
+			if got := itemIDs(cached); got != tt.want {
+				t.Errorf("cached items = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateFeedEmpty(t *testing.T) {
+	tests := []struct {
+		allowEmpty bool
+		wantErr    bool
+		want       string
+	}{
+		{allowEmpty: false, wantErr: true, want: "1,2"},
+		{allowEmpty: true, want: "1,2"},
+	}
+
+	for _, tt := range tests {
+		useTestCache(t)
+		prev := allowEmpty
+		allowEmpty = tt.allowEmpty
+		t.Cleanup(func() { allowEmpty = prev })
+
+		cachePath := filepath.Join(t.TempDir(), cacheFile)
+		srv := newTestFeedServer(t, "1", "2")
+		seedTestCache(t, srv, cachePath)
+
+		feed, err := loadCachedFeed(cachePath)
+		if err != nil {
+			t.Fatalf("loadCachedFeed() error = %s", err)
+		}
+
+		// a feed holding only its title
+		srv.serve(http.StatusOK)
+		if err := updateFeed(srv.Client(), feed, false); (err != nil) != tt.wantErr {
+			t.Errorf("allowEmpty %t: updateFeed() error = %v, want error %t", tt.allowEmpty, err, tt.wantErr)
+		}
+
+		if got := itemIDs(feed); got != tt.want {
+			t.Errorf("allowEmpty %t: items = %s after an empty update, want %s", tt.allowEmpty, got, tt.want)
+		}
+	}
+}
+
+func TestCmdGenerateWithoutLink(t *testing.T) {
+	useTestSite(t)
+	generateFormat = defaultGeneratedSiteFormatting
+
+	dir := t.TempDir()
+	site := filepath.Join(dir, "site")
+	feed := &cachedFeed{Feed: &rss.Feed{Items: []*rss.Item{
+		{ID: "1", Title: "CVE-2021-0001 (openssl)", Link: "https://nvd.nist.gov/vuln/detail/CVE-2021-0001", Summary: "linked"},
+		{ID: "2", Title: "CVE-2021-0002 (openssl)", Summary: "unlinked"},
+	}}}
+	filters := filter.Build(map[string][]string{"openssl": {"openssl"}}, nil, "")
+
+	if err := cmdGenerate(feed, filepath.Join(dir, cacheFile), site, filters, nil, false); err != nil {
+		t.Fatalf("cmdGenerate() error = %s", err)
+	}
+
+	pages := readPages(t, site)
+	tests := []struct {
+		page   string
+		want   []string
+		absent []string
+	}{
+		{
+			page: "cve-2021-0001.md",
+			want: []string{"cve: https://nvd.nist.gov/vuln/detail/CVE-2021-0001\n", `<a href="https://nvd.nist.gov/vuln/detail/CVE-2021-0001">`, "linked"},
+		},
+		{
+			// the page falls back to the CVE id and leaves out the anchor
+			page:   "cve-2021-0002.md",
+			want:   []string{"cve: CVE-2021-0002\n", "unlinked"},
+			absent: []string{"<a ", "href"},
+		},
+	}
+
+	for _, tt := range tests {
+		page, ok := pages[tt.page]
+		if !ok {
+			t.Errorf("%s was not generated, got %d pages", tt.page, len(pages))
+			continue
+		}
+
+		for _, s := range tt.want {
+			if !strings.Contains(page, s) {
+				t.Errorf("%s doesn't contain %q:\n%s", tt.page, s, page)
+			}
+		}
+
+		for _, s := range tt.absent {
+			if strings.Contains(page, s) {
+				t.Errorf("%s contains %q:\n%s", tt.page, s, page)
+			}
+		}
+	}
+}
@@ -0,0 +1,800 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/SlyMarbo/rss"
+	"github.com/ncatelli/sec-feed/filter"
+)
+
+const (
+	pagerDutyEventsURL string = "https://events.pagerduty.com/v2/enqueue"
+
+	defaultNotifyTemplate string = `{{ .Title }}
+{{ .Link }}
+
+{{ .Summary }}`
+
+	// teams rejects payloads over roughly 28KB, so summaries are truncated and
+	// items are split across several cards.
+	teamsMaxSummaryLength int = 2000
+	teamsItemsPerCard     int = 10
+)
+
+// parseNotifyTemplate returns the template rendering the message text of
+// chat notifications, preferring -notify-template over
+// -notify-template-file over the built-in default.
+func parseNotifyTemplate() (*template.Template, error) {
+	body := defaultNotifyTemplate
+	if notifyTemplate != "" {
+		body = notifyTemplate
+	} else if notifyTemplateFile != "" {
+		data, err := os.ReadFile(notifyTemplateFile)
+		if err != nil {
+			return nil, err
+		}
+
+		body = string(data)
+	}
+
+	return template.New("notify").Funcs(templateFuncs).Parse(body)
+}
+
+func renderMessage(tmpl *template.Template, item *rss.Item) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, item); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// notifications holds the state shared by the notifiers and webhook sinks of
+// a run: the items they failed to deliver and, with -notify-log-path, the
+// log of items notified by earlier runs.
+type notifications struct {
+	deliveries *deliveryTracker
+	sentLog    *sentLog
+}
+
+func newNotifications() (*notifications, error) {
+	n := &notifications{deliveries: newDeliveryTracker()}
+	if notifyLogPath == "" {
+		return n, nil
+	}
+
+	var err error
+	if n.sentLog, err = loadSentLog(notifyLogPath, notifyLogRetention, n.deliveries); err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// wrap spaces out and caps the items written to sinks with -notify-rate and
+// -notify-max-per-run, skipping and recording items in the sent log.
+func (n *notifications) wrap(sinks []sink) []sink {
+	if len(sinks) > 0 && (notifyRate > 0 || notifyMaxPerRun > 0) {
+		sinks = []sink{newRateLimitedSink(sinks, notifyRate, notifyMaxPerRun, n.deliveries)}
+	}
+
+	if len(sinks) > 0 && n.sentLog != nil {
+		sinks = []sink{newSentLogSink(sinks, n.sentLog)}
+	}
+
+	return sinks
+}
+
+// notifierKinds are the kinds of notifiers configured by their own flags,
+// in the order they are notified, with the flag enabling each. A route may
+// target a configured notifier by its kind.
+var notifierKinds = []struct {
+	kind string
+	flag string
+}{
+	{kind: "pagerduty", flag: "-pagerduty-routing-key"},
+	{kind: "teams", flag: "-teams-webhook"},
+	{kind: "matrix", flag: "-matrix-homeserver"},
+	{kind: "jira", flag: "-jira-url"},
+	{kind: "github", flag: "-github-repo"},
+}
+
+// newNotifiers returns the configured notifiers by kind, not yet wrapped by
+// n. See notifierSinks.
+func newNotifiers(filters []filter.Filter, n *notifications) (map[string]sink, error) {
+	notifiers := make(map[string]sink)
+	client := &http.Client{Timeout: 10 * time.Second}
+	deliveries := n.deliveries
+
+	tmpl, err := parseNotifyTemplate()
+	if err != nil {
+		return nil, err
+	}
+
+	if pagerDutyRoutingKey != "" {
+		if !validSeverityThreshold(pagerDutyMinSeverity) {
+			return nil, fmt.Errorf("invalid pagerduty severity: %s", pagerDutyMinSeverity)
+		}
+
+		notifiers["pagerduty"] = &pagerDutySink{
+			client:      client,
+			url:         pagerDutyEventsURL,
+			routingKey:  pagerDutyRoutingKey,
+			minSeverity: pagerDutyMinSeverity,
+			deliveries:  deliveries,
+		}
+	}
+
+	if teamsWebhook != "" {
+		notifiers["teams"] = &teamsSink{
+			client:     client,
+			url:        teamsWebhook,
+			tmpl:       tmpl,
+			deliveries: deliveries,
+		}
+	}
+
+	if matrixHomeserver != "" || matrixToken != "" || matrixRoom != "" {
+		if matrixHomeserver == "" || matrixToken == "" || matrixRoom == "" {
+			return nil, errors.New("matrix notifications require -matrix-homeserver, -matrix-token and -matrix-room")
+		}
+
+		notifiers["matrix"] = &matrixSink{
+			client:     client,
+			homeserver: strings.TrimSuffix(matrixHomeserver, "/"),
+			token:      matrixToken,
+			room:       matrixRoom,
+			tmpl:       tmpl,
+			deliveries: deliveries,
+		}
+	}
+
+	if jiraURL != "" {
+		if jiraProject == "" || jiraToken == "" {
+			return nil, errors.New("jira issues require -jira-project and -jira-token")
+		}
+
+		if !validSeverityThreshold(jiraMinSeverity) {
+			return nil, fmt.Errorf("invalid jira severity: %s", jiraMinSeverity)
+		}
+
+		notifiers["jira"] = &jiraSink{
+			client:      client,
+			url:         strings.TrimSuffix(jiraURL, "/"),
+			project:     jiraProject,
+			issueType:   jiraIssueType,
+			user:        jiraUser,
+			token:       jiraToken,
+			minSeverity: jiraMinSeverity,
+			deliveries:  deliveries,
+		}
+	}
+
+	if gitHubRepo != "" {
+		if gitHubToken == "" {
+			return nil, errors.New("github issues require -github-token")
+		}
+
+		if !validSeverityThreshold(gitHubMinSeverity) {
+			return nil, fmt.Errorf("invalid github severity: %s", gitHubMinSeverity)
+		}
+
+		notifiers["github"] = &gitHubSink{
+			client:      client,
+			apiURL:      strings.TrimSuffix(gitHubAPIURL, "/"),
+			repo:        gitHubRepo,
+			token:       gitHubToken,
+			minSeverity: gitHubMinSeverity,
+			filters:     filters,
+			deliveries:  deliveries,
+		}
+	}
+
+	return notifiers, nil
+}
+
+// notifierSinks returns the sinks notified of items by the new command: the
+// notifiers, in the order of notifierKinds, wrapped by n.
+func (n *notifications) notifierSinks(notifiers map[string]sink) []sink {
+	var sinks []sink
+	for _, k := range notifierKinds {
+		if s, ok := notifiers[k.kind]; ok {
+			sinks = append(sinks, s)
+		}
+	}
+
+	return n.wrap(sinks)
+}
+
+// deliveryTracker collects the items a notifier failed to deliver during the
+// run. Notifiers log their failures rather than returning them, so a
+// successful write doesn't mean an item was delivered.
+type deliveryTracker struct {
+	failed map[string]bool
+}
+
+func newDeliveryTracker() *deliveryTracker {
+	return &deliveryTracker{failed: make(map[string]bool)}
+}
+
+// fail records that item was not delivered, or not sent at all.
+func (t *deliveryTracker) fail(item *rss.Item) {
+	t.failed[item.ID] = true
+}
+
+// delivered reports whether no notifier failed the item with the given id.
+func (t *deliveryTracker) delivered(id string) bool {
+	return !t.failed[id]
+}
+
+// sentLog is a persisted log of notified item ids, so clearing the cache
+// doesn't repeat notifications. Items are only recorded once every sink that
+// forwarded items has been flushed, as buffering notifiers only deliver
+// then, and only when every notifier delivered them. Entries older than
+// retention are pruned when the log is saved.
+type sentLog struct {
+	path       string
+	retention  time.Duration
+	sent       map[string]time.Time
+	pending    []string
+	deliveries *deliveryTracker
+	writing    int
+	flushed    int
+}
+
+func loadSentLog(path string, retention time.Duration, deliveries *deliveryTracker) (*sentLog, error) {
+	l := &sentLog{
+		path:       path,
+		retention:  retention,
+		sent:       make(map[string]time.Time),
+		deliveries: deliveries,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &l.sent); err != nil {
+		return nil, fmt.Errorf("failed to parse notification log %s: %s", path, err)
+	}
+
+	return l, nil
+}
+
+// save records the delivered pending items and writes the log once the last
+// sink that forwarded items has been flushed.
+func (l *sentLog) save() error {
+	if l.flushed < l.writing {
+		return nil
+	}
+	l.writing, l.flushed = 0, 0
+
+	now := time.Now()
+	for _, id := range l.pending {
+		if l.deliveries.delivered(id) {
+			l.sent[id] = now
+		}
+	}
+	l.pending = nil
+
+	if l.retention > 0 {
+		cutoff := time.Now().Add(-l.retention)
+		for id, sentAt := range l.sent {
+			if sentAt.Before(cutoff) {
+				delete(l.sent, id)
+			}
+		}
+	}
+
+	data, err := json.Marshal(l.sent)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(l.path, data, 0644)
+}
+
+// sentLogSink skips items already recorded in the sent log, adding the items
+// it forwards to its sinks to the log.
+type sentLogSink struct {
+	sinks   []sink
+	log     *sentLog
+	written bool
+}
+
+func newSentLogSink(sinks []sink, log *sentLog) *sentLogSink {
+	return &sentLogSink{sinks: sinks, log: log}
+}
+
+func (s *sentLogSink) Write(item *rss.Item) error {
+	if _, ok := s.log.sent[item.ID]; ok {
+		verbosef("skipping notification for %s: already notified", item.Title)
+		return nil
+	}
+
+	if !s.written {
+		s.written = true
+		s.log.writing++
+	}
+
+	if err := writeToSinks(s.sinks, item); err != nil {
+		return err
+	}
+
+	s.log.pending = append(s.log.pending, item.ID)
+	return nil
+}
+
+func (s *sentLogSink) Flush() error {
+	if err := flushSinks(s.sinks); err != nil {
+		return err
+	}
+
+	if s.written {
+		s.written = false
+		s.log.flushed++
+	}
+
+	return s.log.save()
+}
+
+// rateLimiter spaces out deliveries to at most one per interval. The first
+// delivery is never delayed, and a nil rateLimiter never waits.
+type rateLimiter struct {
+	interval time.Duration
+	ticker   *time.Ticker
+}
+
+// wait blocks until the next delivery is permitted.
+func (l *rateLimiter) wait() {
+	if l == nil {
+		return
+	}
+
+	if l.ticker == nil {
+		l.ticker = time.NewTicker(l.interval)
+		return
+	}
+
+	<-l.ticker.C
+}
+
+func (l *rateLimiter) stop() {
+	if l != nil && l.ticker != nil {
+		l.ticker.Stop()
+		l.ticker = nil
+	}
+}
+
+// pacedSink is a sink buffering items and delivering them on flush, which
+// spaces out its own deliveries with the given rateLimiter.
+type pacedSink interface {
+	sink
+	pace(limiter *rateLimiter)
+}
+
+// rateLimitedSink spaces out writes to its sinks to at most perMinute items
+// per minute, leaving paced sinks to space out their own deliveries, and
+// stops forwarding items after maxPerRun, sending a single summary of the
+// overflow to the chat notifiers on flush instead.
+type rateLimitedSink struct {
+	sinks      []sink
+	limiter    *rateLimiter
+	maxPerRun  int
+	sent       int
+	overflow   int
+	deliveries *deliveryTracker
+}
+
+func newRateLimitedSink(sinks []sink, perMinute, maxPerRun int, deliveries *deliveryTracker) *rateLimitedSink {
+	s := &rateLimitedSink{sinks: sinks, maxPerRun: maxPerRun, deliveries: deliveries}
+	if perMinute <= 0 {
+		return s
+	}
+
+	interval := time.Minute / time.Duration(perMinute)
+	for _, sink := range sinks {
+		if paced, ok := sink.(pacedSink); ok {
+			paced.pace(&rateLimiter{interval: interval})
+		} else if s.limiter == nil {
+			s.limiter = &rateLimiter{interval: interval}
+		}
+	}
+
+	return s
+}
+
+func (s *rateLimitedSink) Write(item *rss.Item) error {
+	if s.maxPerRun > 0 && s.sent >= s.maxPerRun {
+		s.overflow++
+		s.deliveries.fail(item)
+		return nil
+	}
+
+	s.limiter.wait()
+	s.sent++
+
+	return writeToSinks(s.sinks, item)
+}
+
+func (s *rateLimitedSink) Flush() error {
+	defer s.limiter.stop()
+
+	// the summary isn't an advisory, so it is never paged or filed as an issue
+	var chat []sink
+	for _, sink := range s.sinks {
+		if isChatNotifier(sink) {
+			chat = append(chat, sink)
+		}
+	}
+
+	if s.overflow > 0 && len(chat) > 0 {
+		s.limiter.wait()
+		summary := &rss.Item{
+			Title:   fmt.Sprintf("and %d more", s.overflow),
+			Summary: fmt.Sprintf("%d further new items were not notified after reaching the limit of %d per run.", s.overflow, s.maxPerRun),
+			Date:    time.Now(),
+		}
+
+		if err := writeToSinks(chat, summary); err != nil {
+			return err
+		}
+	}
+	s.overflow = 0
+
+	return flushSinks(s.sinks)
+}
+
+// isChatNotifier reports whether s posts messages to a chat, rather than
+// paging someone or opening an issue.
+func isChatNotifier(s sink) bool {
+	switch s.(type) {
+	case *webhookSink, *teamsSink, *matrixSink:
+		return true
+	default:
+		return false
+	}
+}
+
+// truncateText shortens s to at most n runes, marking the cut with an
+// ellipsis.
+func truncateText(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	} else if n < 1 {
+		return ""
+	}
+
+	return string(runes[:n-1]) + "…"
+}
+
+// postJSON posts v as JSON to url, returning an error for any non-2xx
+// response.
+func postJSON(client *http.Client, url string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("posting to %s returned status %s", url, resp.Status)
+	}
+
+	return nil
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key"`
+	Payload     pagerDutyPayload `json:"payload"`
+	Links       []pagerDutyLink  `json:"links,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+type pagerDutyLink struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+// pagerDutySink triggers a PagerDuty Events API v2 alert for each item at or
+// above minSeverity. The CVE id is used as the dedup key so repeated
+// notifications for an advisory don't page again.
+type pagerDutySink struct {
+	client      *http.Client
+	url         string
+	routingKey  string
+	minSeverity string
+	deliveries  *deliveryTracker
+}
+
+func (s *pagerDutySink) Write(item *rss.Item) error {
+	severity := itemSeverity(item)
+	if severityRank(severity) < severityRank(s.minSeverity) {
+		return nil
+	}
+
+	dedupKey := cveID(item.Title)
+	if dedupKey == "" {
+		dedupKey = item.ID
+	}
+
+	// pagerduty rejects summaries longer than 1024 characters
+	summary := truncateText(item.Title, 1024)
+
+	event := pagerDutyEvent{
+		RoutingKey:  s.routingKey,
+		EventAction: "trigger",
+		DedupKey:    dedupKey,
+		Payload: pagerDutyPayload{
+			Summary:  summary,
+			Source:   "sec-feed",
+			Severity: pagerDutySeverity(severity),
+			CustomDetails: map[string]string{
+				"summary": item.Summary,
+			},
+		},
+	}
+
+	if item.Link != "" {
+		event.Links = []pagerDutyLink{{Href: item.Link, Text: "advisory"}}
+	}
+
+	// a failed page is logged rather than aborting the remaining items.
+	if err := postJSON(s.client, s.url, event); err != nil {
+		log.Printf("failed to trigger pagerduty alert for %s: %s", dedupKey, err)
+		recordError("notify", err, item.ID)
+		s.deliveries.fail(item)
+	}
+
+	return nil
+}
+
+func (s *pagerDutySink) Flush() error {
+	return nil
+}
+
+// pagerDutySeverity maps an item severity onto the PagerDuty event
+// severities.
+func pagerDutySeverity(severity string) string {
+	switch severity {
+	case "critical":
+		return "critical"
+	case "high":
+		return "error"
+	case "medium":
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+type teamsMessageCard struct {
+	Type     string         `json:"@type"`
+	Context  string         `json:"@context"`
+	Summary  string         `json:"summary"`
+	Title    string         `json:"title"`
+	Sections []teamsSection `json:"sections"`
+}
+
+type teamsSection struct {
+	Text            string        `json:"text"`
+	PotentialAction []teamsAction `json:"potentialAction,omitempty"`
+}
+
+type teamsAction struct {
+	Type    string        `json:"@type"`
+	Name    string        `json:"name"`
+	Targets []teamsTarget `json:"targets"`
+}
+
+type teamsTarget struct {
+	OS  string `json:"os"`
+	URI string `json:"uri"`
+}
+
+// teamsSink posts new items to a Microsoft Teams incoming webhook as
+// MessageCards, with one section per item and at most teamsItemsPerCard
+// items per card. Cards are posted on flush, spaced out by limiter when
+// notifications are rate limited.
+type teamsSink struct {
+	client     *http.Client
+	url        string
+	tmpl       *template.Template
+	items      []*rss.Item
+	limiter    *rateLimiter
+	deliveries *deliveryTracker
+}
+
+func (s *teamsSink) pace(limiter *rateLimiter) {
+	s.limiter = limiter
+}
+
+func (s *teamsSink) Write(item *rss.Item) error {
+	s.items = append(s.items, item)
+	return nil
+}
+
+func (s *teamsSink) Flush() error {
+	defer s.limiter.stop()
+
+	for start := 0; start < len(s.items); start += teamsItemsPerCard {
+		end := start + teamsItemsPerCard
+		if end > len(s.items) {
+			end = len(s.items)
+		}
+
+		card, err := newTeamsMessageCard(s.tmpl, s.items[start:end])
+		if err != nil {
+			return err
+		}
+
+		s.limiter.wait()
+		if err := postJSON(s.client, s.url, card); err != nil {
+			log.Printf("failed to post %d items to teams: %s", end-start, err)
+			for _, item := range s.items[start:end] {
+				recordError("notify", err, item.ID)
+				s.deliveries.fail(item)
+			}
+		}
+	}
+
+	s.items = nil
+	return nil
+}
+
+func newTeamsMessageCard(tmpl *template.Template, items []*rss.Item) (teamsMessageCard, error) {
+	title := fmt.Sprintf("%d new vulnerabilities", len(items))
+	if len(items) == 1 {
+		title = "1 new vulnerability"
+	}
+
+	card := teamsMessageCard{
+		Type:    "MessageCard",
+		Context: "http://schema.org/extensions",
+		Summary: title,
+		Title:   title,
+	}
+
+	for _, item := range items {
+		message, err := renderMessage(tmpl, item)
+		if err != nil {
+			return card, err
+		}
+
+		section := teamsSection{
+			Text: truncateText(message, teamsMaxSummaryLength),
+		}
+
+		if item.Link != "" {
+			section.PotentialAction = []teamsAction{{
+				Type:    "OpenUri",
+				Name:    "View advisory",
+				Targets: []teamsTarget{{OS: "default", URI: item.Link}},
+			}}
+		}
+
+		card.Sections = append(card.Sections, section)
+	}
+
+	return card, nil
+}
+
+type matrixMessage struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format"`
+	FormattedBody string `json:"formatted_body"`
+}
+
+type matrixError struct {
+	ErrCode string `json:"errcode"`
+	Error   string `json:"error"`
+}
+
+// matrixSink sends each new item to a Matrix room as an m.room.message event
+// through the client-server API.
+type matrixSink struct {
+	client     *http.Client
+	homeserver string
+	token      string
+	room       string
+	tmpl       *template.Template
+	txn        int
+	deliveries *deliveryTracker
+}
+
+func (s *matrixSink) Write(item *rss.Item) error {
+	if err := s.send(item); err != nil {
+		log.Printf("failed to send %s to matrix room %s: %s", item.Title, s.room, err)
+		recordError("notify", err, item.ID)
+		s.deliveries.fail(item)
+	}
+
+	return nil
+}
+
+func (s *matrixSink) send(item *rss.Item) error {
+	body, err := renderMessage(s.tmpl, item)
+	if err != nil {
+		return err
+	}
+
+	message := matrixMessage{
+		MsgType:       "m.text",
+		Body:          body,
+		Format:        "org.matrix.custom.html",
+		FormattedBody: strings.ReplaceAll(html.EscapeString(body), "\n", "<br>"),
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	s.txn++
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/sec-feed-%d-%d",
+		s.homeserver, url.PathEscape(s.room), time.Now().UnixNano(), s.txn)
+
+	req, err := http.NewRequest(http.MethodPut, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+
+	var merr matrixError
+	respBody, _ := io.ReadAll(resp.Body)
+	json.Unmarshal(respBody, &merr)
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return fmt.Errorf("the homeserver rejected the access token (%s: %s)", merr.ErrCode, merr.Error)
+	case http.StatusForbidden:
+		return fmt.Errorf("the access token is not permitted to post to the room (%s: %s)", merr.ErrCode, merr.Error)
+	default:
+		return fmt.Errorf("the homeserver returned status %s (%s: %s)", resp.Status, merr.ErrCode, merr.Error)
+	}
+}
+
+func (s *matrixSink) Flush() error {
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/SlyMarbo/rss"
+	"github.com/ncatelli/sec-feed/filter"
+)
+
+func TestSentLogSkipsAfterCacheReset(t *testing.T) {
+	useTestCache(t)
+	dir := t.TempDir()
+
+	var posts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&posts, 1)
+	}))
+	defer srv.Close()
+
+	prevPath := notifyLogPath
+	notifyLogPath = filepath.Join(dir, "sent.json")
+	t.Cleanup(func() {
+		notifyLogPath = prevPath
+	})
+
+	filters := filter.Build(map[string][]string{"cve": {"CVE-"}}, nil, "")
+	for run := 1; run <= 2; run++ {
+		n, err := newNotifications()
+		if err != nil {
+			t.Fatalf("run %d: newNotifications() error = %s", run, err)
+		}
+
+		sinks, err := newSinks([]string{"webhook=" + srv.URL}, n)
+		if err != nil {
+			t.Fatalf("run %d: newSinks() error = %s", run, err)
+		}
+
+		// every run starts from an unread cache, as after resetting it
+		feed := &cachedFeed{Feed: &rss.Feed{
+			Items: []*rss.Item{
+				{ID: "1", Title: "CVE-2021-0001 (openssl)"},
+				{ID: "2", Title: "CVE-2021-0002 (nginx)"},
+			},
+			Unread: 2,
+		}}
+
+		if err := cmdNewItems(feed, filepath.Join(dir, cacheFile), filters, true, sinks); err != nil {
+			t.Fatalf("run %d: cmdNewItems() error = %s", run, err)
+		}
+
+		if got := atomic.LoadInt32(&posts); got != 2 {
+			t.Errorf("after run %d the webhook received %d posts, want 2", run, got)
+		}
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{s: "openssl", n: 10, want: "openssl"},
+		{s: "openssl", n: 7, want: "openssl"},
+		{s: "openssl", n: 6, want: "opens…"},
+		{s: "openssl", n: 1, want: "…"},
+		{s: "openssl", n: 0, want: ""},
+		{s: "", n: 0, want: ""},
+		// cut by character, never inside a multi-byte one
+		{s: "ünïcödé", n: 7, want: "ünïcödé"},
+		{s: "ünïcödé", n: 4, want: "ünï…"},
+		{s: "日本語のタイトル", n: 3, want: "日本…"},
+	}
+
+	for _, tt := range tests {
+		got := truncateText(tt.s, tt.n)
+		if got != tt.want {
+			t.Errorf("truncateText(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+
+		if !utf8.ValidString(got) {
+			t.Errorf("truncateText(%q, %d) = %q is not valid UTF-8", tt.s, tt.n, got)
+		}
+	}
+}
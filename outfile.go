@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"syscall"
+	"time"
+)
+
+// fifoPollInterval is how often opening a FIFO is retried while waiting for
+// a reader to attach.
+const fifoPollInterval time.Duration = 100 * time.Millisecond
+
+// outputLock is the lock held on an appended -output-file for the whole run,
+// kept referenced for the same reason as cacheLock.
+var outputLock *os.File
+
+// checkAppendable returns an error when the stdout sink's output, written
+// with the given preset and format string, can't be appended to an existing
+// -output-file. The json preset writes a single array, and appending a second
+// one would leave the file invalid JSON.
+func checkAppendable(preset, format string, split bool) error {
+	if preset == "json" && format == "" && !split {
+		return errors.New("-append can't append a json array to -output-file, use -output ndjson")
+	}
+
+	return nil
+}
+
+// openOutputFile opens the file the stdout sinks write to. Regular files are
+// truncated, or appended to when appending under a lock that is returned so
+// the caller can hold it until the output is flushed and closed, while a FIFO
+// is opened without blocking on a reader. See openFIFO.
+func openOutputFile(path string, appending bool, timeout time.Duration) (io.Writer, *os.File, error) {
+	info, err := os.Stat(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	} else if err == nil && info.Mode()&os.ModeNamedPipe != 0 {
+		w, err := openFIFO(path, timeout)
+		return w, nil, err
+	}
+
+	if !appending {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		return f, nil, err
+	}
+
+	// serialize concurrent runs so their items are never interleaved
+	lock, err := lockFile(path + ".lock")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		lock.Close()
+		return nil, nil, err
+	}
+
+	return f, lock, nil
+}
+
+// openFIFO opens a FIFO for writing without blocking on a reader. If no
+// reader attaches within timeout, output falls back to stdout.
+func openFIFO(path string, timeout time.Duration) (io.Writer, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		// without a reader a non-blocking open fails with ENXIO rather than
+		// waiting indefinitely.
+		f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if err == nil {
+			return f, nil
+		} else if !errors.Is(err, syscall.ENXIO) {
+			return nil, err
+		}
+
+		if time.Now().After(deadline) {
+			log.Printf("WARNING: no reader attached to %s within %s, writing to stdout instead", path, timeout)
+			return os.Stdout, nil
+		}
+
+		time.Sleep(fifoPollInterval)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestCheckAppendable(t *testing.T) {
+	tests := []struct {
+		preset  string
+		format  string
+		split   bool
+		wantErr bool
+	}{
+		{preset: "json", wantErr: true},
+		{preset: "json", format: "{{ .Title }}"},
+		{preset: "json", split: true},
+		{preset: "ndjson"},
+		{preset: "text"},
+		{preset: "csv"},
+	}
+
+	for _, tt := range tests {
+		if err := checkAppendable(tt.preset, tt.format, tt.split); (err != nil) != tt.wantErr {
+			t.Errorf("checkAppendable(%q, %q, %t) error = %v, want error %t", tt.preset, tt.format, tt.split, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/SlyMarbo/rss"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultOutputPreset string = "text"
+
+// streamingOutputPresets are flushed after every item so that streaming
+// consumers receive each one as soon as it is written.
+var streamingOutputPresets = map[string]bool{
+	"ndjson": true,
+}
+
+// outputPresets maps each -output preset name to the template body used to
+// render a single item.
+var outputPresets = map[string]string{
+	"text": defaultOutputFormatting,
+	"json": `{{ json . }}
+`,
+	"ndjson": `{{ json . }}
+`,
+	"markdown": `## [{{ .Title }}]({{ .Link }})
+_{{ .Date }}_
+
+{{ .Summary }}
+
+`,
+	"csv": `{{ csvRecord . }}`,
+	"oneline": `{{ .Date.Format "2006-01-02" }} {{ severityBadge . }} {{ .Title }} {{ .Link }}
+`,
+	"urls": `{{ with .Link }}{{ . }}
+{{ end }}`,
+	"table": `{{ .Date.Format "2006-01-02" }}	{{ cve . }}	{{ severityBadge . }}	{{ .Title }}
+`,
+	"yaml": `{{ yaml . }}`,
+}
+
+// itemRecord is the structured representation of an item used by the
+// machine-readable output presets.
+type itemRecord struct {
+	ID       string    `json:"id"`
+	CVE      string    `json:"cve,omitempty"`
+	Title    string    `json:"title"`
+	Link     string    `json:"link"`
+	Date     time.Time `json:"date"`
+	Summary  string    `json:"summary"`
+	Tags     []string  `json:"tags,omitempty"`
+	Severity string    `json:"severity,omitempty"`
+}
+
+func newItemRecord(item *rss.Item) itemRecord {
+	_, tags := splitTitle(item.Title)
+
+	return itemRecord{
+		ID:       item.ID,
+		CVE:      cveID(item.Title),
+		Title:    item.Title,
+		Link:     item.Link,
+		Date:     item.Date,
+		Summary:  item.Summary,
+		Tags:     tags,
+		Severity: itemSeverity(item),
+	}
+}
+
+// recordFields are the itemRecord fields selectable with -fields, in the
+// order they are output.
+var recordFields = []string{"id", "cve", "title", "link", "date", "summary", "tags", "severity"}
+
+// defaultCSVFields are the columns of the csv preset without -fields.
+var defaultCSVFields = []string{"title", "date", "link", "summary"}
+
+// defaultYAMLFields are the keys of the yaml preset without -fields.
+var defaultYAMLFields = []string{"title", "date", "link", "summary", "tags", "severity"}
+
+// parseFields parses a comma separated -fields list, rejecting names that
+// aren't record fields.
+func parseFields(spec string) ([]string, error) {
+	var fields []string
+	for _, name := range strings.Split(spec, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name == "" {
+			continue
+		}
+
+		if !validRecordField(name) {
+			return nil, fmt.Errorf("unknown field %s, expected one of: %s", name, strings.Join(recordFields, ", "))
+		}
+
+		fields = append(fields, name)
+	}
+
+	return fields, nil
+}
+
+func validRecordField(name string) bool {
+	for _, field := range recordFields {
+		if field == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// field returns the value of the named record field.
+func (r itemRecord) field(name string) interface{} {
+	switch name {
+	case "id":
+		return r.ID
+	case "cve":
+		return r.CVE
+	case "title":
+		return r.Title
+	case "link":
+		return r.Link
+	case "date":
+		return r.Date
+	case "summary":
+		return r.Summary
+	case "tags":
+		return r.Tags
+	case "severity":
+		return r.Severity
+	default:
+		return nil
+	}
+}
+
+// marshalRecord encodes r as a JSON object holding only the -fields, in the
+// order given, or every field without -fields.
+func marshalRecord(r itemRecord) ([]byte, error) {
+	if len(outputFields) == 0 {
+		return json.Marshal(r)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, name := range outputFields {
+		value, err := json.Marshal(r.field(name))
+		if err != nil {
+			return nil, err
+		}
+
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, "%q:%s", name, value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// csvRecord returns the -fields of r, or the default csv columns, as csv
+// values.
+func csvRecord(r itemRecord) []string {
+	fields := outputFields
+	if len(fields) == 0 {
+		fields = defaultCSVFields
+	}
+
+	values := make([]string, 0, len(fields))
+	for _, name := range fields {
+		switch v := r.field(name).(type) {
+		case time.Time:
+			values = append(values, v.Format(time.RFC3339))
+		case []string:
+			values = append(values, strings.Join(v, ","))
+		default:
+			values = append(values, fmt.Sprint(v))
+		}
+	}
+
+	return values
+}
+
+func csvLine(fields ...string) (string, error) {
+	var sb strings.Builder
+
+	w := csv.NewWriter(&sb)
+	if err := w.Write(fields); err != nil {
+		return "", err
+	}
+	w.Flush()
+
+	return sb.String(), w.Error()
+}
+
+// yamlRecord encodes r as a single entry of a YAML sequence holding the
+// -fields, or the default yaml keys omitting empty tags and severity, so the
+// entries of every item together form one YAML document. Multi-line
+// summaries are written as literal block scalars.
+func yamlRecord(r itemRecord) (string, error) {
+	fields := outputFields
+	if len(fields) == 0 {
+		fields = defaultYAMLFields
+	}
+
+	record := &yaml.Node{Kind: yaml.MappingNode}
+	for _, name := range fields {
+		value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str"}
+		switch v := r.field(name).(type) {
+		case time.Time:
+			value.Value = v.Format(time.RFC3339)
+		case []string:
+			if len(v) == 0 && len(outputFields) == 0 {
+				continue
+			}
+
+			value = &yaml.Node{Kind: yaml.SequenceNode}
+			for _, tag := range v {
+				value.Content = append(value.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: tag})
+			}
+		case string:
+			if v == "" && name == "severity" && len(outputFields) == 0 {
+				continue
+			}
+
+			value.Value = v
+			if strings.Contains(v, "\n") {
+				value.Value = blockScalarText(v)
+				value.Style = yaml.LiteralStyle
+			}
+		}
+
+		record.Content = append(record.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, value)
+	}
+
+	var sb strings.Builder
+	enc := yaml.NewEncoder(&sb)
+	enc.SetIndent(2)
+	if err := enc.Encode(&yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{record}}); err != nil {
+		return "", err
+	}
+
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
+}
+
+// blockScalarText normalizes line endings and drops trailing whitespace from
+// every line of text, which would otherwise prevent it being written as a
+// block scalar.
+func blockScalarText(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+var templateFuncs = template.FuncMap{
+	"yaml": func(item *rss.Item) (string, error) {
+		return yamlRecord(newItemRecord(item))
+	},
+	"json": func(item *rss.Item) (string, error) {
+		data, err := marshalRecord(newItemRecord(item))
+		if err != nil {
+			return "", err
+		}
+
+		return string(data), nil
+	},
+	"csv": csvLine,
+	"csvRecord": func(item *rss.Item) (string, error) {
+		return csvLine(csvRecord(newItemRecord(item))...)
+	},
+	"cve": func(item *rss.Item) string {
+		return cveID(item.Title)
+	},
+	"severity":       itemSeverity,
+	"severityBadge":  severityBadge,
+	"cvss":           itemCVSSVector,
+	"severitySymbol": severitySymbol,
+	"relTime": func(t time.Time) string {
+		return relativeTime(t, time.Now())
+	},
+	"score": func(item *rss.Item) int {
+		return itemScore(item, scoredFilters)
+	},
+}
+
+// relTimeUnits are the units relativeTime rounds a duration down to, largest
+// first.
+var relTimeUnits = []struct {
+	name string
+	d    time.Duration
+}{
+	{"year", 365 * 24 * time.Hour},
+	{"month", 30 * 24 * time.Hour},
+	{"day", 24 * time.Hour},
+	{"hour", time.Hour},
+	{"minute", time.Minute},
+}
+
+// relativeTime describes t relative to now, such as "2 hours ago" or
+// "in 3 days". Zero times, common for items without a date, are "unknown".
+func relativeTime(t, now time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+
+	for _, unit := range relTimeUnits {
+		n := int(d / unit.d)
+		if n < 1 {
+			continue
+		}
+
+		desc := fmt.Sprintf("%d %s", n, unit.name)
+		if n > 1 {
+			desc += "s"
+		}
+
+		if future {
+			return "in " + desc
+		}
+		return desc + " ago"
+	}
+
+	return "just now"
+}
+
+func listOutputPresets() []string {
+	names := make([]string, 0, len(outputPresets))
+	for name := range outputPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// parseOutputTemplate returns the template used to render items, preferring
+// an explicit format string over the named preset.
+func parseOutputTemplate(format, preset string) (*template.Template, error) {
+	if format == "" {
+		body, ok := outputPresets[preset]
+		if !ok {
+			return nil, fmt.Errorf("invalid output preset %s, expected one of: %s", preset, strings.Join(listOutputPresets(), ", "))
+		}
+
+		format = body
+	}
+
+	return template.New("output").Funcs(templateFuncs).Parse(format)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// progressInterval is the least time between progress line updates.
+const progressInterval time.Duration = 100 * time.Millisecond
+
+// progress reports how many of total items have been processed on a single
+// line of w, redrawn at most every progressInterval.
+type progress struct {
+	w       io.Writer
+	verb    string
+	total   int
+	n       int
+	drawnAt time.Time
+}
+
+// newProgress returns a progress line on stderr, or nil when stderr isn't a
+// terminal or -quiet is set. A nil progress reports nothing.
+func newProgress(verb string, total int) *progress {
+	if quiet || !isTerminal(os.Stderr) {
+		return nil
+	}
+
+	return &progress{w: os.Stderr, verb: verb, total: total}
+}
+
+// step counts another processed item.
+func (p *progress) step() {
+	if p == nil {
+		return
+	}
+
+	p.n++
+	if now := time.Now(); now.Sub(p.drawnAt) >= progressInterval || p.n == p.total {
+		fmt.Fprintf(p.w, "\r%s %d/%d", p.verb, p.n, p.total)
+		p.drawnAt = now
+	}
+}
+
+// done clears the progress line once every item is processed.
+func (p *progress) done() {
+	if p == nil || p.drawnAt.IsZero() {
+		return
+	}
+
+	fmt.Fprint(p.w, "\r\033[K")
+}
+
+// isTerminal reports whether f is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
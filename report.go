@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"time"
+
+	"github.com/SlyMarbo/rss"
+	"github.com/ncatelli/sec-feed/filter"
+)
+
+// matchReport lists the items selected by each filter during a run, written
+// to -match-report-file to audit which filters are productive.
+type matchReport struct {
+	Time    time.Time                `json:"time"`
+	URL     string                   `json:"url"`
+	Command string                   `json:"command"`
+	Matches map[string][]matchedItem `json:"matches"`
+
+	filters []filter.Filter
+}
+
+// matchedItem identifies an item in the match report.
+type matchedItem struct {
+	GUID  string `json:"guid"`
+	Title string `json:"title"`
+}
+
+// runMatchReport collects the matches of the run when -match-report-file is
+// set.
+var runMatchReport *matchReport
+
+// newMatchReport returns a report listing every filter, so filters without a
+// match are reported with none.
+func newMatchReport(filters []filter.Filter) *matchReport {
+	r := &matchReport{
+		Time:    time.Now().UTC(),
+		URL:     feedUrl,
+		Command: flag.Arg(0),
+		Matches: make(map[string][]matchedItem, len(filters)),
+		filters: filters,
+	}
+
+	for _, filter := range filters {
+		r.Matches[filter.Name] = []matchedItem{}
+	}
+
+	return r
+}
+
+func (r *matchReport) record(item *rss.Item) {
+	for _, name := range filter.MatchedNames(item, r.filters) {
+		r.Matches[name] = append(r.Matches[name], matchedItem{GUID: item.ID, Title: item.Title})
+	}
+}
+
+// write replaces the report at path.
+func (r *matchReport) write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, data, 0644)
+}
+
+// reportingMatcher records every item its selector matches in the report.
+type reportingMatcher struct {
+	selector filter.Matcher
+	report   *matchReport
+}
+
+func (m reportingMatcher) Matches(item *rss.Item) bool {
+	if !m.selector.Matches(item) {
+		return false
+	}
+
+	m.report.record(item)
+	return true
+}
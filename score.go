@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/SlyMarbo/rss"
+	"github.com/ncatelli/sec-feed/filter"
+)
+
+// scoredFilters are the filters the score template helper counts matches
+// against, set once the filters are loaded.
+var scoredFilters []filter.Filter
+
+// itemScore rates the relevance of an item by the number of filters it
+// matches and its severity, each multiplied by its -score-*-weight.
+func itemScore(item *rss.Item, filters []filter.Filter) int {
+	score := filterWeight * len(filter.MatchedNames(item, filters))
+	if rank := severityRank(itemSeverity(item)); rank > 0 {
+		score += severityWeight * rank
+	}
+
+	return score
+}
+
+// topSink holds back every item until flushed, then forwards only the n
+// highest scoring items to its sinks, newest first among equal scores.
+type topSink struct {
+	n       int
+	filters []filter.Filter
+	sinks   []sink
+	items   []*rss.Item
+}
+
+func (s *topSink) Write(item *rss.Item) error {
+	s.items = append(s.items, item)
+	return nil
+}
+
+func (s *topSink) Flush() error {
+	scores := make(map[*rss.Item]int, len(s.items))
+	for _, item := range s.items {
+		scores[item] = itemScore(item, s.filters)
+	}
+
+	sort.SliceStable(s.items, func(i, j int) bool {
+		a, b := s.items[i], s.items[j]
+		if scores[a] != scores[b] {
+			return scores[a] > scores[b]
+		}
+
+		return a.Date.After(b.Date)
+	})
+
+	if len(s.items) > s.n {
+		s.items = s.items[:s.n]
+	}
+
+	for _, item := range s.items {
+		if err := writeToSinks(s.sinks, item); err != nil {
+			return err
+		}
+	}
+	s.items = nil
+
+	return flushSinks(s.sinks)
+}
@@ -0,0 +1,605 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/SlyMarbo/rss"
+	"github.com/ncatelli/sec-feed/filter"
+)
+
+const defaultSink string = "stdout"
+
+// stdout buffers the output of every stdout sink. It is flushed by the sinks
+// once all items are written, and by main before exiting on an error so
+// items rendered before a failure are never lost.
+var stdout = bufio.NewWriter(os.Stdout)
+
+// sink receives every item output by a command. Flush is called once all
+// items have been written, and an error from either method prevents new
+// items from being marked read.
+type sink interface {
+	Write(item *rss.Item) error
+	Flush() error
+}
+
+// stringList is a repeatable flag. Values set on the command line replace
+// the default rather than appending to it.
+type stringList struct {
+	values []string
+	set    bool
+}
+
+func newStringList(defaultVal string) *stringList {
+	l := &stringList{}
+	for _, v := range strings.Split(defaultVal, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			l.values = append(l.values, v)
+		}
+	}
+
+	return l
+}
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+
+	return strings.Join(l.values, ",")
+}
+
+func (l *stringList) Set(val string) error {
+	if !l.set {
+		l.values = nil
+		l.set = true
+	}
+
+	l.values = append(l.values, val)
+	return nil
+}
+
+// newSinks constructs a sink for each spec, formatted as kind or kind=target.
+// Webhook sinks are rate limited and capped like the notifiers of n.
+func newSinks(specs []string, n *notifications) ([]sink, error) {
+	var sinks []sink
+
+	for _, spec := range specs {
+		kind, target, _ := strings.Cut(spec, "=")
+
+		switch kind {
+		case "stdout":
+			tmpl, err := parseOutputTemplate(formatOutput, outputPreset)
+			if err != nil {
+				return nil, err
+			}
+
+			if splitOutput {
+				pathTmpl, err := template.New("path").Funcs(templateFuncs).Parse(outputPathTemplate)
+				if err != nil {
+					return nil, fmt.Errorf("invalid -output-path-template: %s", err)
+				}
+
+				sinks = append(sinks, &splitFileSink{
+					pathTmpl:  pathTmpl,
+					tmpl:      tmpl,
+					normalize: normalizeWhitespace,
+				})
+				continue
+			}
+
+			// json output is a single array rather than a record per item
+			if outputPreset == "json" && formatOutput == "" {
+				sinks = append(sinks, &jsonArraySink{
+					array:     jsonArrayWriter{w: stdout},
+					normalize: normalizeWhitespace,
+				})
+				continue
+			}
+
+			var w flushWriter = stdout
+			if header, ok := tableOutputPresets[outputPreset]; ok && formatOutput == "" {
+				w = &tableWriter{w: stdout, header: header, width: outputWidth()}
+			}
+
+			sinks = append(sinks, &templateSink{
+				w:         w,
+				tmpl:      tmpl,
+				normalize: normalizeWhitespace,
+				flushEach: formatOutput == "" && streamingOutputPresets[outputPreset],
+			})
+		case "json-file":
+			if target == "" {
+				return nil, fmt.Errorf("sink %s requires a file path", kind)
+			}
+
+			sinks = append(sinks, &jsonFileSink{path: target})
+		case "webhook", "webhook-file":
+			if target == "" {
+				return nil, fmt.Errorf("sink %s requires a url", kind)
+			}
+
+			// webhook urls embed their credentials, keep them out of flags
+			if kind == "webhook-file" {
+				data, err := os.ReadFile(target)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read webhook url: %s", err)
+				}
+				target = strings.TrimRight(string(data), "\r\n")
+			}
+
+			tmpl, err := parseNotifyTemplate()
+			if err != nil {
+				return nil, err
+			}
+
+			sinks = append(sinks, n.wrap([]sink{&webhookSink{
+				client: &http.Client{Timeout: 10 * time.Second},
+				url:    target,
+				tmpl:   tmpl,
+			}})...)
+		default:
+			return nil, fmt.Errorf("invalid sink: %s", spec)
+		}
+	}
+
+	return sinks, nil
+}
+
+func writeToSinks(sinks []sink, item *rss.Item) error {
+	for _, s := range sinks {
+		if err := s.Write(item); err != nil {
+			return newItemError(item, err)
+		}
+	}
+
+	return nil
+}
+
+// abortSink is a sink holding partial output, which Abort discards when the
+// run fails before the sink is flushed.
+type abortSink interface {
+	sink
+	Abort()
+}
+
+// abortSinks discards the partial output of sinks after a failed run.
+func abortSinks(sinks []sink) {
+	for _, s := range sinks {
+		if a, ok := s.(abortSink); ok {
+			a.Abort()
+		}
+	}
+}
+
+func flushSinks(sinks []sink) error {
+	for _, s := range sinks {
+		if err := s.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// flushWriter is a writer buffering its output until flushed.
+type flushWriter interface {
+	io.Writer
+	Flush() error
+}
+
+// templateSink renders each item with the output template, optionally
+// collapsing the whitespace in its summary first. With flushEach every item
+// is flushed as soon as it is rendered.
+type templateSink struct {
+	w         flushWriter
+	tmpl      *template.Template
+	normalize bool
+	flushEach bool
+}
+
+func (s *templateSink) Write(item *rss.Item) error {
+	if s.normalize {
+		item = normalizeSummary(item)
+	}
+
+	if err := s.tmpl.Execute(s.w, item); err != nil {
+		return err
+	}
+
+	if s.flushEach {
+		return s.w.Flush()
+	}
+
+	return nil
+}
+
+func (s *templateSink) Flush() error {
+	return s.w.Flush()
+}
+
+// normalizeSummary returns a copy of item with the runs of whitespace in its
+// summary collapsed.
+func normalizeSummary(item *rss.Item) *rss.Item {
+	normalized := *item
+	normalized.Summary = strings.Join(strings.Fields(item.Summary), " ")
+	return &normalized
+}
+
+// splitFileSink renders each item with the output template to its own file,
+// at the path rendered for the item by pathTmpl. Directories are created as
+// needed and every file is replaced atomically.
+type splitFileSink struct {
+	pathTmpl  *template.Template
+	tmpl      *template.Template
+	normalize bool
+}
+
+func (s *splitFileSink) Write(item *rss.Item) error {
+	if s.normalize {
+		item = normalizeSummary(item)
+	}
+
+	var path strings.Builder
+	if err := s.pathTmpl.Execute(&path, item); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(path.String()) == "" {
+		return fmt.Errorf("-output-path-template rendered an empty path for %s", item.Title)
+	}
+
+	var data bytes.Buffer
+	if err := s.tmpl.Execute(&data, item); err != nil {
+		return err
+	}
+
+	name := filepath.Clean(path.String())
+	if err := os.MkdirAll(filepath.Dir(name), dirMode); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(name, encodeFileOutput(data.Bytes()), 0644)
+}
+
+func (s *splitFileSink) Flush() error {
+	return nil
+}
+
+// jsonArrayWriter writes JSON records to w as the elements of an indented
+// array, one at a time so no record is held once it has been written.
+type jsonArrayWriter struct {
+	w     *bufio.Writer
+	count int
+}
+
+func (a *jsonArrayWriter) write(data []byte) error {
+	sep := ",\n  "
+	if a.count == 0 {
+		sep = "[\n  "
+	}
+
+	// indent each record as it would be within an indented array
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "  ", "  "); err != nil {
+		return err
+	}
+
+	a.w.WriteString(sep)
+	a.count++
+	_, err := buf.WriteTo(a.w)
+	return err
+}
+
+// end closes the array, writing an empty array when there were no records,
+// and flushes it.
+func (a *jsonArrayWriter) end() error {
+	if a.count == 0 {
+		a.w.WriteString("[]")
+	} else {
+		a.w.WriteString("\n]")
+	}
+	a.count = 0
+
+	return a.w.Flush()
+}
+
+// jsonArraySink writes items output with the json preset as a single JSON
+// array, ended once all items have been written.
+type jsonArraySink struct {
+	array     jsonArrayWriter
+	normalize bool
+}
+
+func (s *jsonArraySink) Write(item *rss.Item) error {
+	if s.normalize {
+		item = normalizeSummary(item)
+	}
+
+	data, err := marshalRecord(newItemRecord(item))
+	if err != nil {
+		return err
+	}
+
+	return s.array.write(data)
+}
+
+func (s *jsonArraySink) Flush() error {
+	if err := s.array.end(); err != nil {
+		return err
+	}
+
+	s.array.w.WriteByte('\n')
+	return s.array.w.Flush()
+}
+
+// jsonFileSink writes items as a single JSON array, encoding each as it is
+// written to a temporary file that replaces the file at path once all items
+// have been written, so memory use doesn't grow with the number of items.
+type jsonFileSink struct {
+	path  string
+	tmp   *os.File
+	array jsonArrayWriter
+}
+
+func (s *jsonFileSink) Write(item *rss.Item) error {
+	data, err := marshalRecord(newItemRecord(item))
+	if err != nil {
+		s.Abort()
+		return err
+	}
+
+	if s.tmp == nil {
+		tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+		if err != nil {
+			return err
+		}
+		s.tmp = tmp
+		s.array = jsonArrayWriter{w: bufio.NewWriter(s.tmp)}
+	}
+
+	if err := s.array.write(data); err != nil {
+		s.Abort()
+		return err
+	}
+
+	return nil
+}
+
+// Abort removes the temporary file of a partially written array, leaving the
+// file at path untouched.
+func (s *jsonFileSink) Abort() {
+	if s.tmp == nil {
+		return
+	}
+
+	s.tmp.Close()
+	os.Remove(s.tmp.Name())
+	s.tmp = nil
+}
+
+func (s *jsonFileSink) Flush() error {
+	if s.tmp == nil {
+		return writeFileAtomic(s.path, []byte("[]"), 0644)
+	}
+
+	tmp := s.tmp
+	s.tmp = nil
+	defer os.Remove(tmp.Name())
+
+	if err := s.array.end(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// webhookPayload is posted for each item. The text field makes the payload
+// directly usable with Slack compatible incoming webhooks.
+type webhookPayload struct {
+	Text string     `json:"text"`
+	Item itemRecord `json:"item"`
+}
+
+// webhookSink posts each item to url as JSON, with the text field rendered
+// by the notification template.
+type webhookSink struct {
+	client *http.Client
+	url    string
+	tmpl   *template.Template
+}
+
+func (s *webhookSink) Write(item *rss.Item) error {
+	text, err := renderMessage(s.tmpl, item)
+	if err != nil {
+		return err
+	}
+
+	return postJSON(s.client, s.url, webhookPayload{
+		Text: text,
+		Item: newItemRecord(item),
+	})
+}
+
+func (s *webhookSink) Flush() error {
+	return nil
+}
+
+// route sends items whose severity or matched filter equals value to its
+// sinks, or to the notifier of its kind when it targets one.
+type route struct {
+	field    string
+	value    string
+	sinks    []sink
+	notifier string
+}
+
+// routingSink dispatches each item to the sinks of every route it matches,
+// or to the fallback sinks when it matches none.
+type routingSink struct {
+	routes    []route
+	fallback  []sink
+	filters   []filter.Filter
+	notifiers map[string][]sink
+}
+
+// newRoutingSink parses route specs, formatted as field:value=sink where
+// field is severity or filter and sink is any -sink spec or the kind of a
+// configured notifier. Routed notifiers are wrapped by n and removed from
+// notifiers, so they're only notified of the items routed to them. Routes to
+// notifiers are dropped when notifiers is nil, as only the new command
+// notifies. Items with no parseable severity match the severity value
+// unknown.
+func newRoutingSink(specs []string, fallback []sink, filters []filter.Filter, notifiers map[string]sink, n *notifications) (*routingSink, error) {
+	r := &routingSink{fallback: fallback, filters: filters, notifiers: make(map[string][]sink)}
+
+	for _, spec := range specs {
+		field, rest, _ := strings.Cut(spec, ":")
+		value, target, ok := strings.Cut(rest, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid route %s, expected field:value=sink", spec)
+		}
+
+		switch field {
+		case "severity", "filter":
+		default:
+			return nil, fmt.Errorf("invalid route field %s, expected severity or filter", field)
+		}
+
+		if flag, ok := notifierFlag(target); ok {
+			if notifiers == nil {
+				continue
+			}
+
+			if _, ok := r.notifiers[target]; !ok {
+				s, ok := notifiers[target]
+				if !ok {
+					return nil, fmt.Errorf("invalid route %s, the %s notifier requires %s", spec, target, flag)
+				}
+
+				r.notifiers[target] = n.wrap([]sink{s})
+				delete(notifiers, target)
+			}
+
+			r.routes = append(r.routes, route{field: field, value: value, notifier: target})
+			continue
+		}
+
+		sinks, err := newSinks([]string{target}, n)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %s: %s", spec, err)
+		}
+
+		r.routes = append(r.routes, route{field: field, value: value, sinks: sinks})
+	}
+
+	return r, nil
+}
+
+// notifierFlag returns the flag configuring the notifier of the given kind.
+func notifierFlag(kind string) (string, bool) {
+	for _, k := range notifierKinds {
+		if k.kind == kind {
+			return k.flag, true
+		}
+	}
+
+	return "", false
+}
+
+func (r *routingSink) Write(item *rss.Item) error {
+	severity := itemSeverity(item)
+	if severity == "" {
+		severity = "unknown"
+	}
+	matched := filter.MatchedNames(item, r.filters)
+
+	routed := false
+	notified := make(map[string]bool)
+	for _, rt := range r.routes {
+		switch {
+		case rt.field == "severity" && strings.EqualFold(rt.value, severity):
+		case rt.field == "filter" && containsString(matched, rt.value):
+		default:
+			continue
+		}
+
+		routed = true
+		sinks := rt.sinks
+		if rt.notifier != "" {
+			// notify once however many of its routes match
+			if notified[rt.notifier] {
+				continue
+			}
+			notified[rt.notifier] = true
+			sinks = r.notifiers[rt.notifier]
+		}
+
+		if err := writeToSinks(sinks, item); err != nil {
+			return err
+		}
+	}
+
+	if routed {
+		return nil
+	}
+
+	return writeToSinks(r.fallback, item)
+}
+
+func (r *routingSink) Flush() error {
+	for _, rt := range r.routes {
+		if err := flushSinks(rt.sinks); err != nil {
+			return err
+		}
+	}
+
+	for _, k := range notifierKinds {
+		if err := flushSinks(r.notifiers[k.kind]); err != nil {
+			return err
+		}
+	}
+
+	return flushSinks(r.fallback)
+}
+
+func (r *routingSink) Abort() {
+	for _, rt := range r.routes {
+		abortSinks(rt.sinks)
+	}
+
+	for _, k := range notifierKinds {
+		abortSinks(r.notifiers[k.kind])
+	}
+
+	abortSinks(r.fallback)
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/SlyMarbo/rss"
+	"github.com/ncatelli/sec-feed/filter"
+)
+
+// benchmarkItems returns 5000 items with summaries of a typical advisory's
+// length.
+func benchmarkItems() []*rss.Item {
+	summary := strings.Repeat("A flaw allows a remote attacker to execute code. ", 10)
+	items := make([]*rss.Item, 5000)
+	for i := range items {
+		items[i] = &rss.Item{
+			ID:      fmt.Sprint(i),
+			Title:   fmt.Sprintf("CVE-2021-%05d (vendor%02d, prod%03d_lib)", i, i%97, i%1000),
+			Link:    fmt.Sprintf("https://example.com/%d", i),
+			Summary: summary,
+		}
+	}
+
+	return items
+}
+
+// heldHeap returns the bytes of heap in use after a garbage collection.
+func heldHeap(b *testing.B) uint64 {
+	b.StopTimer()
+	defer b.StartTimer()
+
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	return stats.HeapAlloc
+}
+
+// reportHeld reports the most heap held on top of base by any iteration,
+// which bounds the peak memory of writing the records.
+func reportHeld(b *testing.B, base, held uint64) {
+	if held > base {
+		b.ReportMetric(float64(held-base), "held-B")
+	} else {
+		b.ReportMetric(0, "held-B")
+	}
+}
+
+func BenchmarkJSONArraySink(b *testing.B) {
+	items := benchmarkItems()
+	base, held := heldHeap(b), uint64(0)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		s := &jsonArraySink{array: jsonArrayWriter{w: bufio.NewWriter(io.Discard)}}
+		for _, item := range items {
+			if err := s.Write(item); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		if h := heldHeap(b); h > held {
+			held = h
+		}
+		if err := s.Flush(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportHeld(b, base, held)
+}
+
+// BenchmarkJSONMarshalAll collects every record before marshaling them as
+// one array, as the json outputs did before streaming their records.
+func BenchmarkJSONMarshalAll(b *testing.B) {
+	items := benchmarkItems()
+	base, held := heldHeap(b), uint64(0)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		var records []itemRecord
+		for _, item := range items {
+			records = append(records, newItemRecord(item))
+		}
+
+		data, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if h := heldHeap(b); h > held {
+			held = h
+		}
+		io.Discard.Write(data)
+	}
+	reportHeld(b, base, held)
+}
+
+func TestRoutingSinkNotifiers(t *testing.T) {
+	pagerDuty, teams, fallback := &discardSink{}, &discardSink{}, &discardSink{}
+	notifiers := map[string]sink{"pagerduty": pagerDuty, "teams": teams}
+	filters := []filter.Filter{{Name: "ssl", Label: "ssl", Matcher: filter.SubstringMatcher{Term: "openssl"}}}
+	n := &notifications{deliveries: newDeliveryTracker()}
+
+	r, err := newRoutingSink([]string{"severity:critical=pagerduty", "filter:ssl=pagerduty"}, []sink{fallback}, filters, notifiers, n)
+	if err != nil {
+		t.Fatalf("newRoutingSink() error = %s", err)
+	}
+
+	for _, title := range []string{
+		"CVE-2021-0001 (openssl) severity: critical",
+		"CVE-2021-0002 (openssl) severity: low",
+		"CVE-2021-0003 (nginx) severity: critical",
+		"CVE-2021-0004 (nginx) severity: low",
+	} {
+		if err := r.Write(&rss.Item{ID: title, Title: title}); err != nil {
+			t.Fatalf("Write(%q) error = %s", title, err)
+		}
+	}
+
+	if pagerDuty.items != 3 || fallback.items != 1 || teams.items != 0 {
+		t.Errorf("routed pagerduty %d, fallback %d, teams %d items, want 3, 1 and 0", pagerDuty.items, fallback.items, teams.items)
+	}
+
+	if _, ok := notifiers["pagerduty"]; ok {
+		t.Errorf("routed pagerduty notifier is still notified of every item")
+	}
+
+	if _, ok := notifiers["teams"]; !ok {
+		t.Errorf("unrouted teams notifier was removed")
+	}
+}
+
+func TestNewRoutingSinkTargets(t *testing.T) {
+	n := &notifications{deliveries: newDeliveryTracker()}
+
+	tests := []struct {
+		spec      string
+		notifiers map[string]sink
+		routes    int
+		wantErr   string
+	}{
+		{spec: "severity:critical=json-file=critical.json", notifiers: map[string]sink{}, routes: 1},
+		{spec: "severity:critical=teams", notifiers: map[string]sink{"teams": &discardSink{}}, routes: 1},
+		{spec: "severity:critical=matrix", notifiers: map[string]sink{}, wantErr: "requires -matrix-homeserver"},
+		{spec: "severity:critical=slack", notifiers: map[string]sink{}, wantErr: "invalid sink: slack"},
+		{spec: "cvss:9=json-file=critical.json", notifiers: map[string]sink{}, wantErr: "invalid route field cvss"},
+		// commands other than new drop routes to notifiers
+		{spec: "severity:critical=matrix", notifiers: nil, routes: 0},
+	}
+
+	for _, tt := range tests {
+		r, err := newRoutingSink([]string{tt.spec}, nil, nil, tt.notifiers, n)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("newRoutingSink(%q) error = %v, want %q", tt.spec, err, tt.wantErr)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("newRoutingSink(%q) error = %s", tt.spec, err)
+		} else if len(r.routes) != tt.routes {
+			t.Errorf("newRoutingSink(%q) has %d routes, want %d", tt.spec, len(r.routes), tt.routes)
+		}
+	}
+}
+
+func TestNormalizeSummary(t *testing.T) {
+	tests := []struct {
+		summary string
+		want    string
+	}{
+		{summary: "A flaw in openssl.", want: "A flaw in openssl."},
+		{summary: "\n\tA flaw\n\n\tin  openssl.\t\n", want: "A flaw in openssl."},
+		{summary: "A\r\nflaw in openssl.", want: "A flaw in openssl."},
+		{summary: " \n\t ", want: ""},
+		{summary: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		item := &rss.Item{Title: "CVE-2021-0001", Summary: tt.summary}
+		if got := normalizeSummary(item).Summary; got != tt.want {
+			t.Errorf("normalizeSummary(%q) = %q, want %q", tt.summary, got, tt.want)
+		}
+
+		// the cached item keeps its original formatting
+		if item.Summary != tt.summary {
+			t.Errorf("normalizeSummary(%q) changed the item's summary to %q", tt.summary, item.Summary)
+		}
+	}
+}
+
+func TestTemplateSinkNormalize(t *testing.T) {
+	item := &rss.Item{Title: "CVE-2021-0001", Summary: "\n\tA flaw\n\n\tin  openssl.\t\n"}
+
+	for _, normalize := range []bool{false, true} {
+		var sb strings.Builder
+		s := &templateSink{
+			w:         bufio.NewWriter(&sb),
+			tmpl:      template.Must(template.New("output").Parse("{{ .Summary }}")),
+			normalize: normalize,
+		}
+
+		if err := s.Write(item); err != nil {
+			t.Fatalf("Write() error = %s", err)
+		}
+		if err := s.Flush(); err != nil {
+			t.Fatalf("Flush() error = %s", err)
+		}
+
+		want := item.Summary
+		if normalize {
+			want = "A flaw in openssl."
+		}
+
+		if sb.String() != want {
+			t.Errorf("normalize %t: wrote %q, want %q", normalize, sb.String(), want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/SlyMarbo/rss"
+	"github.com/ncatelli/sec-feed/filter"
+)
+
+const filterStatsFile string = "filter-stats.json"
+
+// filterStatsSink records when each filter last matched a new item, persisted
+// alongside the cache so filters that no longer match can be found.
+type filterStatsSink struct {
+	path        string
+	filters     []filter.Filter
+	lastMatched map[string]time.Time
+}
+
+// loadFilterLastMatched reads the last matched time of each filter from path,
+// returning an empty set when no filter has matched yet.
+func loadFilterLastMatched(path string) (map[string]time.Time, error) {
+	lastMatched := make(map[string]time.Time)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return lastMatched, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &lastMatched); err != nil {
+		return nil, fmt.Errorf("failed to parse filter stats %s: %s", path, err)
+	}
+
+	return lastMatched, nil
+}
+
+func newFilterStatsSink(path string, filters []filter.Filter) (*filterStatsSink, error) {
+	lastMatched, err := loadFilterLastMatched(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &filterStatsSink{
+		path:        path,
+		filters:     filters,
+		lastMatched: lastMatched,
+	}, nil
+}
+
+func (s *filterStatsSink) Write(item *rss.Item) error {
+	now := time.Now()
+	for _, name := range filter.MatchedNames(item, s.filters) {
+		s.lastMatched[name] = now
+	}
+
+	return nil
+}
+
+func (s *filterStatsSink) Flush() error {
+	data, err := json.Marshal(s.lastMatched)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.path, data, cacheFileMode)
+}
+
+// cmdStats prints when each filter last matched a new item, flagging filters
+// that have never matched, followed by the labels of the disabled filters.
+func cmdStats(w io.Writer, statsFilePath string, filters []filter.Filter, disabled []string) error {
+	lastMatched, err := loadFilterLastMatched(statsFilePath)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILTER\tLAST MATCHED")
+	now := time.Now()
+	for _, filter := range filters {
+		matchedAt, ok := lastMatched[filter.Name]
+		if !ok {
+			fmt.Fprintf(tw, "%s\tnever\n", filter.Label)
+			continue
+		}
+
+		fmt.Fprintf(tw, "%s\t%s (%s)\n", filter.Label, matchedAt.Format(time.RFC3339), relativeTime(matchedAt, now))
+	}
+
+	for _, name := range disabled {
+		fmt.Fprintf(tw, "%s\tdisabled\n", name)
+	}
+
+	return tw.Flush()
+}
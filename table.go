@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/SlyMarbo/rss"
+)
+
+// tableOutputPresets render tab separated cells that are aligned into
+// columns, keyed by preset name to the header of each column.
+var tableOutputPresets = map[string][]string{
+	"table": {"DATE", "CVE", "SEVERITY", "TITLE"},
+}
+
+// severitySymbols mark each severity rating in table output, colored when
+// color is enabled. Items of unknown severity get a neutral marker.
+var severitySymbols = map[string]struct {
+	symbol string
+	color  string
+}{
+	"critical": {"●", "\x1b[31m"},
+	"high":     {"●", "\x1b[33m"},
+	"medium":   {"●", "\x1b[93m"},
+	"low":      {"●", "\x1b[32m"},
+	"none":     {"●", "\x1b[90m"},
+}
+
+const (
+	unknownSeveritySymbol string = "○"
+	colorReset            string = "\x1b[0m"
+)
+
+// severityBadge returns an item's severity rating after its marker, or only
+// the neutral marker when the rating is unknown.
+func severityBadge(item *rss.Item) string {
+	severity := itemSeverity(item)
+	if severity == "" {
+		return unknownSeveritySymbol
+	}
+
+	return severitySymbol(severity) + " " + severity
+}
+
+// severitySymbol returns the marker of a severity rating, colored unless
+// color is disabled.
+func severitySymbol(severity string) string {
+	s, ok := severitySymbols[severity]
+	if !ok {
+		return unknownSeveritySymbol
+	}
+
+	if !colorEnabled() {
+		return s.symbol
+	}
+
+	return s.color + s.symbol + colorReset
+}
+
+// colorEnabled reports whether output is colored. An explicit -color always
+// or never wins, otherwise FORCE_COLOR colors output anywhere unless set to
+// 0, NO_COLOR never colors it, and output is only colored when stdout is a
+// terminal written to directly.
+func colorEnabled() bool {
+	switch colorMode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+
+	if force, ok := os.LookupEnv("FORCE_COLOR"); ok {
+		return force != "0"
+	}
+
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+
+	return outputFile == "" && !splitOutput && isTerminal(os.Stdout)
+}
+
+// tableWriter buffers tab separated rows until flushed, then writes them to w
+// aligned into columns under a header. With a width the last column is
+// truncated so rows fit on a single line.
+type tableWriter struct {
+	w      *bufio.Writer
+	header []string
+	width  int
+	buf    bytes.Buffer
+}
+
+func (t *tableWriter) Write(p []byte) (int, error) {
+	return t.buf.Write(p)
+}
+
+func (t *tableWriter) Flush() error {
+	text := strings.TrimRight(t.buf.String(), "\n")
+	t.buf.Reset()
+	if text == "" {
+		return t.w.Flush()
+	}
+
+	rows := [][]string{t.header}
+	for _, line := range strings.Split(text, "\n") {
+		rows = append(rows, strings.Split(line, "\t"))
+	}
+
+	widths := columnWidths(rows)
+	if t.width > 0 {
+		truncateLastColumn(rows, widths, t.width)
+	}
+
+	// cells are padded by their visible width, so colored cells still align
+	for _, row := range rows {
+		for i, cell := range row {
+			t.w.WriteString(cell)
+			if i < len(row)-1 {
+				t.w.WriteString(strings.Repeat(" ", widths[i]-visibleWidth(cell)+tablePadding))
+			}
+		}
+
+		if err := t.w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+
+	return t.w.Flush()
+}
+
+const tablePadding int = 2
+
+var ansiEscapePattern = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// visibleWidth returns the number of characters cell takes up on a terminal,
+// ignoring color escapes.
+func visibleWidth(cell string) int {
+	return utf8.RuneCountInString(ansiEscapePattern.ReplaceAllString(cell, ""))
+}
+
+// columnWidths returns the widest visible cell of every column but the last,
+// which is never padded.
+func columnWidths(rows [][]string) []int {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+
+			if n := visibleWidth(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	return widths
+}
+
+// truncateLastColumn shortens the last cell of every row so the aligned row
+// is no wider than width, leaving rows that already fit untouched.
+func truncateLastColumn(rows [][]string, widths []int, width int) {
+	used := 0
+	for _, w := range widths[:len(widths)-1] {
+		used += w + tablePadding
+	}
+
+	// always leave room for a few characters of the last column
+	const minWidth = 10
+	max := width - used
+	if max < minWidth {
+		max = minWidth
+	}
+
+	for _, row := range rows {
+		last := row[len(row)-1]
+		if utf8.RuneCountInString(last) > max {
+			row[len(row)-1] = string([]rune(last)[:max-3]) + "..."
+		}
+	}
+}
+
+// outputWidth returns the width table output is truncated to, from COLUMNS or
+// the terminal stdout is attached to, or 0 when writing anywhere else.
+func outputWidth() int {
+	if outputFile != "" {
+		return 0
+	}
+
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+
+	return terminalWidth(os.Stdout)
+}
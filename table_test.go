@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestColorEnabled(t *testing.T) {
+	saved, savedOutput := colorMode, outputFile
+	t.Cleanup(func() { colorMode, outputFile = saved, savedOutput })
+	// stdout isn't detected as a terminal while writing to a file
+	outputFile = "out.txt"
+
+	unset := "unset"
+	tests := []struct {
+		mode    string
+		noColor string
+		force   string
+		want    bool
+	}{
+		{mode: "auto", noColor: unset, force: unset, want: false},
+		{mode: "auto", noColor: "1", force: unset, want: false},
+		{mode: "auto", noColor: "", force: unset, want: false},
+		{mode: "auto", noColor: unset, force: "1", want: true},
+		{mode: "auto", noColor: unset, force: "", want: true},
+		{mode: "auto", noColor: unset, force: "0", want: false},
+		{mode: "auto", noColor: "1", force: "1", want: true},
+		{mode: "always", noColor: "1", force: unset, want: true},
+		{mode: "always", noColor: unset, force: "0", want: true},
+		{mode: "never", noColor: unset, force: "1", want: false},
+		{mode: "never", noColor: unset, force: unset, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode+"/NO_COLOR="+tt.noColor+"/FORCE_COLOR="+tt.force, func(t *testing.T) {
+			for name, value := range map[string]string{"NO_COLOR": tt.noColor, "FORCE_COLOR": tt.force} {
+				t.Setenv(name, value)
+				if value == unset {
+					os.Unsetenv(name)
+				}
+			}
+
+			colorMode = tt.mode
+			if got := colorEnabled(); got != tt.want {
+				t.Errorf("colorEnabled() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
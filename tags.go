@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadTagAliases reads a file mapping tag synonyms to a canonical tag, one
+// alias=tag pair per line. Blank lines and lines starting with # are
+// ignored, and both sides are compared case insensitively.
+func loadTagAliases(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	aliases := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		alias, tag, ok := strings.Cut(text, "=")
+		alias, tag = strings.TrimSpace(alias), strings.TrimSpace(tag)
+		if !ok || alias == "" || tag == "" {
+			return nil, fmt.Errorf("%s:%d: expected alias=tag", path, line)
+		}
+
+		aliases[strings.ToLower(alias)] = strings.ToLower(tag)
+	}
+
+	return aliases, scanner.Err()
+}
+
+// normalizeTags lowercases tags, replaces aliases with their canonical tag
+// and drops duplicates, keeping the first occurrence of each tag.
+func normalizeTags(tags []string, aliases map[string]string) []string {
+	seen := make(map[string]struct{}, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if canonical, ok := aliases[tag]; ok {
+			tag = canonical
+		}
+
+		if _, ok := seen[tag]; ok || tag == "" {
+			continue
+		}
+
+		seen[tag] = struct{}{}
+		normalized = append(normalized, tag)
+	}
+
+	return normalized
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"os"
+)
+
+// terminalWidth is not detected on this platform, so table output is only
+// truncated to COLUMNS.
+func terminalWidth(f *os.File) int {
+	return 0
+}
@@ -0,0 +1,24 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// terminalWidth returns the column count of the terminal f is attached to, or
+// 0 when it isn't a terminal.
+func terminalWidth(f *os.File) int {
+	var ws struct {
+		rows, cols, x, y uint16
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return 0
+	}
+
+	return int(ws.cols)
+}